@@ -0,0 +1,115 @@
+// Package api 提供以校務系統頁面為資料來源的 JSON API。
+//
+// 資料端點以呼叫者自己的 Cookie 經由代理向校務系統取得頁面，再解析成結構化資料，
+// 代理本身不保存密碼；常用功能端點則讀寫 session store 中該學號的紀錄。
+package api
+
+import (
+	"better-myUT/portal"
+	"better-myUT/proxy"
+	"better-myUT/session"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// 各資料所在的校務系統頁面路徑（可含查詢字串）
+type Paths struct {
+	Grades    string
+	Timetable string
+}
+
+// 預設的校務系統頁面路徑
+func DefaultPaths() Paths {
+	return Paths{
+		Grades:    "/utaipei/ag_pro/ag008.jsp",
+		Timetable: "/utaipei/ag_pro/ag222.jsp",
+	}
+}
+
+// JSON API 設定
+type Config struct {
+	Paths      Paths
+	Periods    portal.PeriodTimes // 頁面未列出上課時間時使用的節次時間
+	Semester   portal.Semester    // 學期起訖日期，iCalendar 匯出需要；未設定時為零值
+	Sessions   *session.Store     // 常用功能、最近使用紀錄與課表訂閱用的課表
+	FeedSecret string             // 課表訂閱網址的簽章金鑰，未設定時每次啟動隨機產生
+}
+
+// JSON API 服務
+type Service struct {
+	proxy   *proxy.Server
+	cfg     Config
+	feedKey []byte
+}
+
+func New(p *proxy.Server, cfg Config) *Service {
+	return &Service{proxy: p, cfg: cfg, feedKey: newFeedKey(cfg.FeedSecret)}
+}
+
+// 以呼叫者的 session 透過代理取得校務系統頁面
+func (s *Service) fetchPage(r *http.Request, path string) (string, error) {
+	if session.ID(r) == "" {
+		return "", portal.ErrNotLoggedIn
+	}
+
+	target, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("頁面路徑 %q 不合法: %w", path, err)
+	}
+
+	// 只保留 Cookie、User-Agent 等與 session 相關的標頭，其餘依一般瀏覽頁面請求設定
+	req := r.Clone(r.Context())
+	req.Method = http.MethodGet
+	req.URL = &url.URL{Path: target.Path, RawQuery: target.RawQuery}
+	req.Body = nil
+	req.ContentLength = 0
+	for _, key := range []string{"Origin", "Referer", "X-Requested-With", "Content-Type", "Accept"} {
+		req.Header.Del(key)
+	}
+	// 要求未壓縮的內容以便解析
+	req.Header.Set("Accept-Encoding", "identity")
+
+	resp, body, err := s.proxy.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: 校務系統回應 %d", errUpstreamStatus, resp.StatusCode)
+	}
+	return string(body), nil
+}
+
+// 上游回應非 200
+var errUpstreamStatus = errors.New("校務系統回應異常")
+
+// 依錯誤類型回傳 JSON 錯誤：未登入 401、上游錯誤依代理的錯誤分類
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, portal.ErrNotLoggedIn):
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "not_logged_in", Message: err.Error()})
+	case errors.Is(err, errUpstreamStatus):
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: "upstream_error", Message: err.Error()})
+	default:
+		kind := proxy.ClassifyError(err)
+		log.Printf("❌ API 取得校務系統頁面失敗 (%s): %v", kind, err)
+		writeJSON(w, kind.Status(), errorResponse{Error: string(kind), Message: err.Error()})
+	}
+}
+
+type errorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
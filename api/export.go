@@ -0,0 +1,132 @@
+package api
+
+import (
+	"better-myUT/export"
+	"better-myUT/portal"
+	"better-myUT/proxy"
+	"better-myUT/rewrite"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 表格匯出端點
+const ExportPath = "/api/v1/export"
+
+// 執行順序：在 table-labels 之後、table-cards 之前，按鈕才會留在卡片清單上方
+const OrderTableExport = proxy.OrderTableLabels + 20
+
+// 為 HTML 頁面中的資料表格加上 CSV / Excel 下載按鈕的頁面轉換器
+//
+// 只處理 GET 請求的頁面：匯出時會以 GET 重新取得同一頁，POST 查詢結果無法重現。
+func ExportTransformer() rewrite.Transformer {
+	return rewrite.Stage{
+		ID:       "table-export",
+		Priority: OrderTableExport,
+		Matcher:  proxy.HTMLPage,
+		Fn: func(ctx context.Context, page *rewrite.Page) error {
+			r := page.Request
+			if r == nil || r.Method != http.MethodGet {
+				return nil
+			}
+			pagePath := r.URL.RequestURI()
+			page.Body = rewrite.AddTableExportLinks(ctx, page.Body, func(index int, format string) string {
+				return ExportURL(pagePath, index, format)
+			})
+			return nil
+		},
+	}
+}
+
+// 匯出指定頁面第 index 個表格（從 1 開始）的網址
+func ExportURL(pagePath string, index int, format string) string {
+	query := url.Values{}
+	query.Set("path", pagePath)
+	query.Set("table", strconv.Itoa(index))
+	query.Set("format", format)
+	return ExportPath + "?" + query.Encode()
+}
+
+// GET /api/v1/export?path=/utaipei/...&table=1&format=csv：
+// 以呼叫者的 session 重新取得頁面，將第 N 個表格匯出為 CSV 或 XLSX 附件
+func (s *Service) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pagePath := query.Get("path")
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = export.FormatCSV
+	}
+	index, err := strconv.Atoi(query.Get("table"))
+
+	switch {
+	case !strings.HasPrefix(pagePath, "/") || strings.HasPrefix(pagePath, "//"):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_path", Message: "path 必須為校務系統頁面的絕對路徑，例如 /utaipei/ag_pro/ag008.jsp"})
+		return
+	case err != nil || index < 1:
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_table", Message: "table 必須為從 1 開始的表格序號"})
+		return
+	case export.ContentTypes[format] == "":
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_format", Message: "format 僅支援 csv、xlsx"})
+		return
+	}
+
+	page, err := s.fetchPage(r, pagePath)
+	if err == nil && portal.LoginRequired(page) {
+		err = portal.ErrNotLoggedIn
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	tables, err := rewrite.ParseTables(page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if index > len(tables) {
+		writeJSON(w, http.StatusNotFound, errorResponse{
+			Error:   "table_not_found",
+			Message: fmt.Sprintf("頁面中只有 %d 個表格", len(tables)),
+		})
+		return
+	}
+
+	// 沒有偵測到表頭時 Labels 為 nil，只輸出資料列
+	table := tables[index-1]
+	header, rows := table.Labels, table.Rows
+
+	name := exportFileName(pagePath, index)
+	w.Header().Set("Content-Type", export.ContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := export.Write(w, format, name, header, rows); err != nil {
+		log.Printf("❌ 匯出表格失敗 (%s 第 %d 個表格): %v", pagePath, index, err)
+		return
+	}
+	log.Printf("📥 匯出表格: %s 第 %d 個表格 (%s, %d 列)", pagePath, index, format, len(rows))
+}
+
+// 以頁面檔名與表格序號命名，例如 ag008-table1
+func exportFileName(pagePath string, index int) string {
+	if u, err := url.Parse(pagePath); err == nil {
+		pagePath = u.Path
+	}
+	base := strings.TrimSuffix(path.Base(pagePath), path.Ext(pagePath))
+	if base == "" || base == "." || base == "/" {
+		base = "table"
+	}
+	base = strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r < 0x20 || r > 0x7e {
+			return '_'
+		}
+		return r
+	}, base)
+	return fmt.Sprintf("%s-table%d", base, index)
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"better-myUT/portal"
+	"better-myUT/session"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// 常用功能 API 回應
+type FavoritesResponse struct {
+	Favorites []session.Function `json:"favorites"`
+	Recent    []session.Function `json:"recent"`
+}
+
+// 加入常用功能的請求
+type FavoriteRequest struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	Path string `json:"path"` // 功能頁路徑，例如 /utaipei/ag_pro/ag008.jsp
+}
+
+// GET /api/v1/favorites：目前登入學生的常用功能與最近使用
+func (s *Service) FavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	student, ok := s.student(w, r)
+	if !ok {
+		return
+	}
+	s.writeFavorites(w, student)
+}
+
+// POST /api/v1/favorites：加入常用功能，已存在時移到最前面
+func (s *Service) AddFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	student, ok := s.student(w, r)
+	if !ok {
+		return
+	}
+
+	var req FavoriteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_request", Message: "無效的請求格式"})
+		return
+	}
+	// 只給路徑時由路徑推得功能代碼
+	if req.Code == "" {
+		if u, err := url.Parse(req.Path); err == nil {
+			req.Code, _ = session.FunctionCode(u)
+		}
+	}
+
+	fn := session.Function{Code: req.Code, Name: req.Name, Path: req.Path}
+	if !session.ValidFunction(fn) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_function", Message: "path 必須為功能頁路徑（例如 /utaipei/ag_pro/ag008.jsp），且與 code 相符"})
+		return
+	}
+	if err := s.cfg.Sessions.AddFavorite(student, fn); err != nil {
+		if errors.Is(err, session.ErrTooManyFavorites) {
+			writeJSON(w, http.StatusConflict, errorResponse{Error: "too_many_favorites", Message: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid_function", Message: err.Error()})
+		return
+	}
+	log.Printf("⭐ 已加入常用功能: %s", fn.Code)
+	s.writeFavorites(w, student)
+}
+
+// DELETE /api/v1/favorites?code=：移除常用功能
+func (s *Service) RemoveFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	student, ok := s.student(w, r)
+	if !ok {
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if err := s.cfg.Sessions.RemoveFavorite(student, code); err != nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "favorite_not_found", Message: err.Error()})
+		return
+	}
+	log.Printf("⭐ 已移除常用功能: %s", code)
+	s.writeFavorites(w, student)
+}
+
+func (s *Service) writeFavorites(w http.ResponseWriter, student string) {
+	profile := s.cfg.Sessions.Profile(student)
+	writeJSON(w, http.StatusOK, FavoritesResponse{Favorites: profile.Favorites, Recent: profile.Recent})
+}
+
+// 取得呼叫者 session 登入的學號；沒有 session 或尚未對應到學號時回傳 401
+func (s *Service) student(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := session.ID(r)
+	if id == "" {
+		writeError(w, portal.ErrNotLoggedIn)
+		return "", false
+	}
+	student, ok := s.cfg.Sessions.Student(id)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "session_not_bound", Message: session.ErrNotBound.Error()})
+		return "", false
+	}
+	return student, true
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"better-myUT/portal"
+	"better-myUT/session"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 課表行事曆訂閱網址的路徑前綴：/api/v1/timetable/feed/<token>.ics
+const TimetableFeedPath = "/api/v1/timetable/feed/"
+
+// 簽章長度（位元組），截短 HMAC-SHA256 以縮短網址
+const feedSignatureSize = 16
+
+// 訂閱網址簽章用的金鑰；未設定時每次啟動隨機產生，重啟後舊的訂閱網址即失效
+func newFeedKey(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	log.Printf("⚠️  未設定 api.feedSecret，課表訂閱網址將在重啟後失效")
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+// 學生的課表訂閱 token：學號與其 HMAC 簽章，不含 session 資訊
+func (s *Service) feedToken(student string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(student)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.feedSignature(student))
+}
+
+// 驗證訂閱 token 並取出學號
+func (s *Service) feedStudent(token string) (string, bool) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false
+	}
+	student, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(student) == 0 {
+		return "", false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, s.feedSignature(string(student))) {
+		return "", false
+	}
+	return string(student), true
+}
+
+func (s *Service) feedSignature(student string) []byte {
+	mac := hmac.New(sha256.New, s.feedKey)
+	mac.Write([]byte("timetable-feed:" + student))
+	return mac.Sum(nil)[:feedSignatureSize]
+}
+
+// 呼叫者的課表訂閱網址，沿用請求中的學期起訖日期；session 尚未對應到學號時回傳空字串
+func (s *Service) feedURL(r *http.Request, student string) string {
+	if student == "" {
+		return ""
+	}
+	u := s.proxy.PublicBase(r) + TimetableFeedPath + s.feedToken(student) + ".ics"
+	query := url.Values{}
+	for _, key := range []string{"start", "end"} {
+		if value := r.URL.Query().Get(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// 呼叫者 session 對應的學號，未知時回傳空字串
+func (s *Service) sessionStudent(r *http.Request) string {
+	if s.cfg.Sessions == nil {
+		return ""
+	}
+	student, _ := s.cfg.Sessions.Student(session.ID(r))
+	return student
+}
+
+// 保存學生的課表，供行事曆訂閱使用
+func (s *Service) cacheTimetable(student string, classes []portal.Class) {
+	if s.cfg.Sessions == nil || student == "" {
+		return
+	}
+	data, err := json.Marshal(classes)
+	if err != nil {
+		log.Printf("⚠️  保存課表失敗: %v", err)
+		return
+	}
+	s.cfg.Sessions.SaveTimetable(student, data)
+}
+
+// GET /api/v1/timetable/feed/<token>.ics：手機行事曆訂閱用的課表
+//
+// 訂閱請求不會帶上瀏覽器的 cookie，因此以 token 辨識學生，輸出該學生最近一次
+// 經由 /api/v1/timetable 或 /api/v1/timetable.ics 取得並保存的課表。
+func (s *Service) TimetableFeedHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, TimetableFeedPath), ".ics")
+	student, ok := s.feedStudent(token)
+	if !ok || s.cfg.Sessions == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "feed_not_found", Message: "訂閱網址無效或已失效"})
+		return
+	}
+
+	data, updated, ok := s.cfg.Sessions.Timetable(student)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "timetable_not_cached", Message: "尚未保存課表，請登入後開啟一次課表"})
+		return
+	}
+	var classes []portal.Class
+	if err := json.Unmarshal(data, &classes); err != nil {
+		log.Printf("❌ 讀取保存的課表失敗: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "timetable_unreadable", Message: "保存的課表無法讀取，請登入後重新開啟課表"})
+		return
+	}
+
+	semester, ok := s.semester(r)
+	if !ok {
+		writeSemesterRequired(w)
+		return
+	}
+
+	log.Printf("🗓️ 課表訂閱: %d 堂課（保存於 %s）", len(classes), updated.Format("2006-01-02 15:04"))
+	writeICalendar(w, classes, semester)
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"better-myUT/portal"
+	"log"
+	"net/http"
+)
+
+// 成績 API 回應
+type GradesResponse struct {
+	Grades []portal.Grade `json:"grades"`
+}
+
+// GET /api/v1/grades：以呼叫者的 session 查詢各學期成績
+func (s *Service) GradesHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := s.fetchPage(r, s.cfg.Paths.Grades)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	grades, err := portal.ParseGrades(page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	log.Printf("📊 成績 API: 解析出 %d 筆成績", len(grades))
+	writeJSON(w, http.StatusOK, GradesResponse{Grades: grades})
+}
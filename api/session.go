@@ -0,0 +1,46 @@
+package api
+
+import (
+	"better-myUT/session"
+	"net/http"
+	"time"
+)
+
+// session 狀態 API 回應
+type SessionResponse struct {
+	LoggedIn   bool       `json:"loggedIn"`
+	State      string     `json:"state"` // none（沒有 session cookie）、unknown、logged_in、expired
+	StudentID  string     `json:"studentId,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	Since      *time.Time `json:"since,omitempty"`      // 代理第一次看到此 session 登入的時間
+	AgeSeconds int64      `json:"ageSeconds,omitempty"` // 登入至今的秒數
+	LastSeen   *time.Time `json:"lastSeen,omitempty"`
+}
+
+// GET /api/v1/session：呼叫者在校務系統的登入狀態，依代理最近轉送的回應判斷
+func (s *Service) SessionHandler(w http.ResponseWriter, r *http.Request) {
+	id := session.ID(r)
+	if id == "" {
+		writeJSON(w, http.StatusOK, SessionResponse{State: "none"})
+		return
+	}
+
+	info, ok := s.cfg.Sessions.Info(id)
+	if !ok {
+		writeJSON(w, http.StatusOK, SessionResponse{State: string(session.StateUnknown)})
+		return
+	}
+
+	resp := SessionResponse{
+		LoggedIn:  info.State == session.StateLoggedIn,
+		State:     string(info.State),
+		StudentID: info.Student,
+		Name:      info.Name,
+		LastSeen:  &info.LastSeen,
+	}
+	if resp.LoggedIn {
+		resp.Since = &info.Since
+		resp.AgeSeconds = int64(time.Since(info.Since).Seconds())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"better-myUT/portal"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 課表 API 回應
+type TimetableResponse struct {
+	Classes []portal.Class `json:"classes"`
+	FeedURL string         `json:"feedUrl,omitempty"` // 手機行事曆訂閱網址，session 尚未對應到學號時省略
+}
+
+// GET /api/v1/timetable：以呼叫者的 session 查詢本學期每週課表
+func (s *Service) TimetableHandler(w http.ResponseWriter, r *http.Request) {
+	classes, err := s.timetable(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	log.Printf("🗓️ 課表 API: 解析出 %d 堂課", len(classes))
+	writeJSON(w, http.StatusOK, TimetableResponse{Classes: classes, FeedURL: s.feedURL(r, s.sessionStudent(r))})
+}
+
+// GET /api/v1/timetable.ics：課表的每週重複 iCalendar 行事曆
+//
+// 學期起訖日期取自設定，也可用 ?start=2025-09-08&end=2026-01-16 指定。
+func (s *Service) TimetableICSHandler(w http.ResponseWriter, r *http.Request) {
+	semester, ok := s.semester(r)
+	if !ok {
+		writeSemesterRequired(w)
+		return
+	}
+
+	classes, err := s.timetable(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeICalendar(w, classes, semester)
+}
+
+// 以呼叫者的 session 取得課表，並保存一份供行事曆訂閱使用
+func (s *Service) timetable(r *http.Request) ([]portal.Class, error) {
+	page, err := s.fetchPage(r, s.cfg.Paths.Timetable)
+	if err != nil {
+		return nil, err
+	}
+	classes, err := portal.ParseTimetable(page, s.cfg.Periods)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheTimetable(s.sessionStudent(r), classes)
+	return classes, nil
+}
+
+func writeICalendar(w http.ResponseWriter, classes []portal.Class, semester portal.Semester) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="timetable.ics"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := portal.WriteICalendar(w, classes, semester, time.Now()); err != nil {
+		log.Printf("❌ 輸出課表行事曆失敗: %v", err)
+	}
+}
+
+func writeSemesterRequired(w http.ResponseWriter) {
+	writeJSON(w, http.StatusBadRequest, errorResponse{
+		Error:   "semester_dates_required",
+		Message: "未設定學期起訖日期，請設定 api.semesterStart / api.semesterEnd 或以 ?start=YYYY-MM-DD&end=YYYY-MM-DD 指定",
+	})
+}
+
+// 學期起訖日期：查詢參數優先，其次為設定值
+func (s *Service) semester(r *http.Request) (portal.Semester, bool) {
+	semester := s.cfg.Semester
+	for key, target := range map[string]*time.Time{"start": &semester.Start, "end": &semester.End} {
+		if raw := r.URL.Query().Get(key); raw != "" {
+			date, err := time.ParseInLocation(time.DateOnly, raw, portal.Taipei)
+			if err != nil {
+				return semester, false
+			}
+			*target = date
+		}
+	}
+	if semester.Start.IsZero() || semester.End.IsZero() || semester.End.Before(semester.Start) {
+		return semester, false
+	}
+	return semester, true
+}
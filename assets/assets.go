@@ -1,6 +1,9 @@
 package assets
 
-import "embed"
+import (
+	"embed"
+	"strings"
+)
 
 //go:embed fonts.css
 var FontsCSS string
@@ -26,9 +29,24 @@ var HeaderCSS string
 //go:embed tables.css
 var TablesCSS string
 
+//go:embed cards.css
+var CardsCSS string
+
+//go:embed quickaccess.css
+var QuickAccessCSS string
+
+//go:embed keepalive.css
+var KeepAliveCSS string
+
 //go:embed injected.js
 var InjectedJS string
 
+//go:embed quickaccess.js
+var QuickAccessJS string
+
+//go:embed errorpage.html
+var ErrorPageHTML string
+
 //go:embed font/TaipeiSansTCBeta-Light.ttf
 var TaipeiSansLight []byte
 
@@ -41,5 +59,44 @@ var TaipeiSansBold []byte
 //go:embed img/*
 var ImgFS embed.FS
 
+// CSSModule 為單一 CSS 模組的檔名與內容
+type CSSModule struct {
+	Name    string
+	Content string
+}
+
+// CSSModules 依注入順序列出所有 CSS 模組
+var CSSModules = []CSSModule{
+	{"fonts.css", FontsCSS},
+	{"base.css", BaseCSS},
+	{"buttons.css", ButtonsCSS},
+	{"forms.css", FormsCSS},
+	{"sidebar.css", SidebarCSS},
+	{"modal.css", ModalCSS},
+	{"header.css", HeaderCSS},
+	{"tables.css", TablesCSS},
+	{"cards.css", CardsCSS},
+	{"quickaccess.css", QuickAccessCSS},
+	{"keepalive.css", KeepAliveCSS},
+}
+
+// InjectedJSName 為注入腳本的檔名，供覆寫目錄使用
+const InjectedJSName = "injected.js"
+
+// CombineCSS 依序組合 CSS 模組，load 可回傳覆寫內容（ok 為 false 時使用嵌入版本）
+func CombineCSS(load func(name string) (content string, ok bool)) string {
+	parts := make([]string, 0, len(CSSModules))
+	for _, m := range CSSModules {
+		content := m.Content
+		if load != nil {
+			if override, ok := load(m.Name); ok {
+				content = override
+			}
+		}
+		parts = append(parts, content)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
 // CombinedCSS 將所有 CSS 模組組合成一個字串
-var CombinedCSS = FontsCSS + "\n\n" + BaseCSS + "\n\n" + ButtonsCSS + "\n\n" + FormsCSS + "\n\n" + SidebarCSS + "\n\n" + ModalCSS + "\n\n" + HeaderCSS + "\n\n" + TablesCSS
+var CombinedCSS = CombineCSS(nil)
@@ -1,3 +1,6 @@
+// 記錄視窗寬度，讓代理在窄螢幕時把清單表格轉成卡片（不支援 client hints 的瀏覽器使用）
+document.cookie = 'myut_vw=' + Math.round(window.innerWidth) + '; path=/; max-age=31536000; SameSite=Lax';
+
 window.addEventListener('load', () => {
     // 頁面完全載入
     const banner = frames['banner'];
@@ -27,11 +30,86 @@ window.addEventListener('load', () => {
 
     setInterval(insertFooter(main), 200);
 
+    // 從 /go/<功能代碼> 深層連結進來並登入後，在主框架開啟該功能
+    openPendingFunction(main);
+
+    // 分頁可見時定期保持上游 session，快逾時時在主框架顯示警告
+    startKeepAlive(main);
+
     // 添加側邊欄搜尋功能
     setTimeout(initSearch, 1000);
 });
 
 
+function openPendingFunction(frame) {
+    const match = document.cookie.match(/(?:^|;\s*)myut_go=([^;]+)/);
+    if (!match || !frame) {
+        return;
+    }
+    document.cookie = 'myut_go=; path=/; max-age=0; SameSite=Lax';
+    const code = decodeURIComponent(match[1]);
+    console.log('🔗 開啟深層連結功能:', code);
+    frame.location.href = '/go/' + encodeURIComponent(code) + '?resume=1';
+}
+
+
+function startKeepAlive(frame) {
+    let timer = null;
+    const ping = () => {
+        if (document.visibilityState !== 'visible') {
+            return;
+        }
+        fetch('/api/v1/keepalive', { method: 'POST', credentials: 'same-origin' })
+            .then(response => {
+                if (response.status === 404) {
+                    // 代理未啟用保持連線
+                    clearInterval(timer);
+                    document.removeEventListener('visibilitychange', ping);
+                    return null;
+                }
+                return response.ok ? response.json() : null;
+            })
+            .then(data => {
+                if (data) {
+                    updateSessionWarning(frame, data);
+                }
+            })
+            .catch(error => console.error('❌ 保持連線失敗:', error));
+    };
+    timer = setInterval(ping, 60 * 1000);
+    document.addEventListener('visibilitychange', ping);
+    ping();
+}
+
+
+function updateSessionWarning(frame, data) {
+    if (!frame || !frame.document || !frame.document.body) {
+        return;
+    }
+    const doc = frame.document;
+    let banner = doc.getElementById('myutSessionWarning');
+    if (!data.warn || data.reason === 'no_session') {
+        if (banner) {
+            banner.remove();
+        }
+        return;
+    }
+    if (!banner) {
+        banner = doc.createElement('div');
+        banner.id = 'myutSessionWarning';
+        banner.className = 'myut-session-warning';
+        banner.setAttribute('role', 'alert');
+        doc.body.insertBefore(banner, doc.body.firstChild);
+    }
+    if (data.reason === 'expired') {
+        banner.textContent = '⚠️ 校務系統登入已逾時，請先複製已填寫的內容再重新登入。';
+    } else {
+        const minutes = Math.max(1, Math.ceil(data.expiresIn / 60));
+        banner.textContent = '⏳ 校務系統登入約 ' + minutes + ' 分鐘後逾時，請儘快送出或儲存表單。';
+    }
+}
+
+
 function insertFooter(frame) {
     if (frame.document.getElementById('customFooter')) {
         console.log('✅ Footer 已存在，跳過插入');
@@ -200,6 +278,30 @@ function createSearchUI(menuFrame) {
     });
 }
 
+// 向後端查詢並依排名對應回選單項目（模糊、注音、拼音與同義詞比對）
+// 後端在代理轉送這個選單頁時已為目前的 session 建立索引；尚未建立或查詢失敗時回傳 null，改用本地比對
+function searchMenuOnServer(query, menuItems) {
+    const params = new URLSearchParams({ q: query, limit: '50' });
+    return fetch('/api/menu/search?' + params.toString())
+        .then(response => response.ok ? response.json() : null)
+        .then(data => {
+            if (!data || !Array.isArray(data.results)) {
+                return null;
+            }
+            return data.results
+                .filter(result => result.type === 'function')
+                .map(result => {
+                    const item = menuItems.find(item => item.type === 'function' && item.code === result.code);
+                    return item ? Object.assign({}, item, { path: result.path || [] }) : null;
+                })
+                .filter(item => item !== null);
+        })
+        .catch(error => {
+            console.error('❌ 伺服器搜尋失敗，改用本地搜尋:', error);
+            return null;
+        });
+}
+
 // 發送所有 HTML 到後端處理
 function sendAllHTMLToBackend(doc, callback) {
     console.log('🔄 發送所有 HTML 到後端處理...');
@@ -380,11 +482,23 @@ function showSearchResults(query, menuItems, resultsDiv, statsDiv, originalTree,
         })));
     }
 
-    const matches = menuItems.filter(item =>
-        item.type === 'function' && item.text.toLowerCase().includes(query.toLowerCase())
-    );
+    searchMenuOnServer(query, menuItems).then(serverMatches => {
+        // 查詢期間輸入已變更則放棄這次結果
+        const input = doc.getElementById('searchInput');
+        if (input && input.value !== query) {
+            return;
+        }
+
+        const matches = Array.isArray(serverMatches) ? serverMatches : menuItems.filter(item =>
+            item.type === 'function' && item.text.toLowerCase().includes(query.toLowerCase())
+        );
 
-    console.log(`✅ 找到 ${matches.length} 個匹配項目`);
+        console.log(`✅ 找到 ${matches.length} 個匹配項目`);
+        renderSearchResults(matches, resultsDiv, statsDiv, originalTree, doc);
+    });
+}
+
+function renderSearchResults(matches, resultsDiv, statsDiv, originalTree, doc) {
 
     // 清空結果容器
     resultsDiv.innerHTML = '';
@@ -441,6 +555,16 @@ function showSearchResults(query, menuItems, resultsDiv, statsDiv, originalTree,
             textSpan.style.fontWeight = '500';
             textSpan.textContent = item.text + (item.code ? ` (${item.code})` : '');
 
+            // 顯示所在分類，方便分辨同名功能
+            if (item.path && item.path.length > 0) {
+                const pathDiv = doc.createElement('div');
+                pathDiv.style.fontSize = '12px';
+                pathDiv.style.color = '#6c757d';
+                pathDiv.style.fontWeight = 'normal';
+                pathDiv.textContent = item.path.join(' › ');
+                textSpan.appendChild(pathDiv);
+            }
+
             const typeSpan = doc.createElement('span');
             typeSpan.style.fontSize = '12px';
             typeSpan.style.color = '#6c757d';
@@ -0,0 +1,58 @@
+// 快速存取列：「加入常用」按鈕呼叫 /api/v1/favorites 新增或移除目前功能，「分享」按鈕複製 /go/<功能代碼> 連結
+(function () {
+    const bar = document.currentScript && document.currentScript.previousElementSibling;
+    if (!bar || !bar.classList.contains('myut-quick-access')) {
+        return;
+    }
+    const share = bar.querySelector('.myut-share-link');
+    if (share) {
+        share.addEventListener('click', () => {
+            const link = location.origin + '/go/' + encodeURIComponent(bar.dataset.code);
+            if (navigator.share) {
+                navigator.share({ title: bar.dataset.name, url: link }).catch(() => {});
+            } else if (navigator.clipboard) {
+                navigator.clipboard.writeText(link)
+                    .then(() => alert('已複製連結：' + link))
+                    .catch(() => prompt('複製此連結：', link));
+            } else {
+                prompt('複製此連結：', link);
+            }
+        });
+    }
+
+    const button = bar.querySelector('.myut-fav-toggle');
+    if (!button) {
+        return;
+    }
+
+    button.addEventListener('click', () => {
+        const favorite = button.getAttribute('aria-pressed') === 'true';
+        const request = favorite
+            ? fetch('/api/v1/favorites?code=' + encodeURIComponent(bar.dataset.code), { method: 'DELETE' })
+            : fetch('/api/v1/favorites', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ code: bar.dataset.code, name: bar.dataset.name, path: bar.dataset.path })
+            });
+
+        button.disabled = true;
+        request
+            .then(response => response.json().then(data => ({ ok: response.ok, data })))
+            .then(({ ok, data }) => {
+                if (!ok) {
+                    alert(data.message || '更新常用功能失敗');
+                    return;
+                }
+                button.setAttribute('aria-pressed', favorite ? 'false' : 'true');
+                button.textContent = favorite ? '☆' : '★';
+                button.title = favorite ? '加入常用' : '移除常用';
+                console.log(favorite ? '✅ 已移除常用功能' : '✅ 已加入常用功能');
+            })
+            .catch(error => {
+                console.error('❌ 更新常用功能失敗:', error);
+            })
+            .finally(() => {
+                button.disabled = false;
+            });
+    });
+})();
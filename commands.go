@@ -0,0 +1,146 @@
+package main
+
+import (
+	"better-myUT/proxy"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// 印出子命令說明
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `用法: better-myUT <子命令> [參數]
+
+子命令:
+  serve          啟動代理伺服器（預設）
+  check          驗證設定並探測上游校務系統
+  fetch <路徑>   透過代理抓取單一頁面，將優化後的內容輸出到標準輸出
+  version        顯示版本與建置資訊
+  help           顯示此說明
+
+各子命令皆接受相同的設定參數，執行 better-myUT <子命令> -h 查看完整清單。
+`)
+}
+
+// check：驗證設定並探測上游，全部通過時回傳 0
+func checkCommand(args []string) int {
+	cfg, opts, err := loadConfig("check", args, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if len(opts.args) > 0 {
+		fmt.Fprintf(os.Stderr, "❌ 未知的參數: %s\n", strings.Join(opts.args, " "))
+		return 2
+	}
+
+	fmt.Printf("✅ 設定驗證通過\n")
+	fmt.Printf("   公開網址: %s\n", cfg.ProxyURL)
+	fmt.Printf("   上游網址: %s\n", cfg.TargetURL)
+	if opts.configFile != "" {
+		fmt.Printf("   設定檔:   %s\n", opts.configFile)
+	}
+
+	status := proxy.NewUpstreamProber(cfg.TargetURL, time.Duration(cfg.Upstream.StatusTTL)).Status()
+	if !status.Up {
+		fmt.Printf("❌ 上游無法使用 (%dms): %s\n", status.LatencyMs, status.LastError)
+		return 1
+	}
+	fmt.Printf("✅ 上游可連線: 狀態碼=%d (%dms)\n", status.StatusCode, status.LatencyMs)
+	return 0
+}
+
+// fetch：以與伺服器相同的流程（Do + 頁面轉換管線）抓取單一頁面並輸出，方便除錯 CSS 注入
+func fetchCommand(args []string) int {
+	cfg, opts, err := loadConfig("fetch", args, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if len(opts.args) != 1 {
+		fmt.Fprintln(os.Stderr, "用法: better-myUT fetch [參數] <路徑>，例如 better-myUT fetch /utaipei/index_sky.html")
+		return 2
+	}
+
+	target := opts.args[0]
+	if !strings.HasPrefix(target, "/") {
+		target = "/" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 無法解析路徑: %v\n", err)
+		return 2
+	}
+
+	myUTProxy, err := newProxyServer(cfg, nil, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 創建代理失敗: %v\n", err)
+		return 1
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 建立請求失敗: %v\n", err)
+		return 1
+	}
+
+	resp, body, err := myUTProxy.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 代理請求失敗 (%s): %v\n", proxy.ClassifyError(err), err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	contentType := resp.Header.Get("Content-Type")
+	body, applied := myUTProxy.Transform(req, resp.StatusCode, contentType, body)
+	if len(applied) > 0 {
+		log.Printf("已套用頁面轉換器: %s", strings.Join(applied, ", "))
+	}
+
+	fmt.Fprintf(os.Stderr, "狀態: %s, Content-Type: %s, 長度: %d\n", resp.Status, contentType, len(body))
+	if _, err := os.Stdout.Write(body); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// version：顯示模組版本、Go 版本與 VCS 資訊
+func versionCommand(w io.Writer) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		fmt.Fprintln(w, "better-myUT (無建置資訊)")
+		return
+	}
+
+	fmt.Fprintf(w, "better-myUT %s\n", info.Main.Version)
+	fmt.Fprintf(w, "  Go:       %s\n", info.GoVersion)
+
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	if rev := settings["vcs.revision"]; rev != "" {
+		if settings["vcs.modified"] == "true" {
+			rev += " (含未提交的修改)"
+		}
+		fmt.Fprintf(w, "  Commit:   %s\n", rev)
+	}
+	if t := settings["vcs.time"]; t != "" {
+		fmt.Fprintf(w, "  建置時間: %s\n", t)
+	}
+	fmt.Fprintf(w, "  平台:     %s/%s\n", settings["GOOS"], settings["GOARCH"])
+}
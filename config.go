@@ -0,0 +1,829 @@
+package main
+
+import (
+	"better-myUT/api"
+	"better-myUT/cookies"
+	"better-myUT/menu"
+	"better-myUT/portal"
+	"better-myUT/proxy"
+	"better-myUT/rewrite"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// 設定檔與環境變數中使用的時間長度，格式同 time.ParseDuration（例如 "30s"、"200ms"）
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// 代理的完整設定
+//
+// 優先順序（高到低）：命令列參數 > 環境變數 > 設定檔 > 預設值。
+// 每個欄位的 env / flag 標籤分別對應環境變數與命令列參數名稱，
+// 標記 secret 的欄位在 --print-config 時會被遮蔽；標記 clearable 的欄位可用空的環境變數清空（例如不送出某個標頭），
+// 其餘欄位的空環境變數視為未設定。
+type Config struct {
+	Port      int    `yaml:"port" toml:"port" env:"PORT" flag:"port" usage:"伺服器監聽埠"`
+	ProxyURL  string `yaml:"proxyURL" toml:"proxyURL" env:"PROXY_URL" flag:"proxy-url" usage:"部署後對外的完整網址，用於改寫 HTML 與重定向"`
+	TargetURL string `yaml:"targetURL" toml:"targetURL" env:"TARGET_URL" flag:"target-url" usage:"上游校務系統根網址"`
+
+	Server       ServerConfig       `yaml:"server" toml:"server"`
+	TLS          TLSConfig          `yaml:"tls" toml:"tls"`
+	Forwarded    ForwardedConfig    `yaml:"forwarded" toml:"forwarded"`
+	Upstream     UpstreamConfig     `yaml:"upstream" toml:"upstream"`
+	Breaker      BreakerConfig      `yaml:"breaker" toml:"breaker"`
+	Maintenance  MaintenanceConfig  `yaml:"maintenance" toml:"maintenance"`
+	Tracing      TracingConfig      `yaml:"tracing" toml:"tracing"`
+	Assets       AssetsConfig       `yaml:"assets" toml:"assets"`
+	Rewrite      RewriteConfig      `yaml:"rewrite" toml:"rewrite"`
+	CORS         CORSConfig         `yaml:"cors" toml:"cors"`
+	Transformers TransformersConfig `yaml:"transformers" toml:"transformers"`
+	API          APIConfig          `yaml:"api" toml:"api"`
+	Menu         MenuConfig         `yaml:"menu" toml:"menu"`
+	Session      SessionConfig      `yaml:"session" toml:"session"`
+	Go           GoConfig           `yaml:"go" toml:"go"`
+	WarmUp       WarmUpConfig       `yaml:"warmUp" toml:"warmUp"`
+	Login        LoginConfig        `yaml:"login" toml:"login"`
+	KeepAlive    KeepAliveConfig    `yaml:"keepAlive" toml:"keepAlive"`
+	Cookies      CookiesConfig      `yaml:"cookies" toml:"cookies"`
+	Security     SecurityConfig     `yaml:"security" toml:"security"`
+}
+
+type ServerConfig struct {
+	ShutdownTimeout Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"收到結束訊號後等待進行中請求完成的最長時間"`
+	ReusePort       bool     `yaml:"reusePort" toml:"reusePort" env:"LISTEN_REUSEPORT" flag:"reuse-port" usage:"以 SO_REUSEPORT 監聽，供零停機重啟使用"`
+}
+
+// 內建 HTTPS（不經 Nginx / Traefik 直接對外時使用），憑證檔案變動時自動重新載入
+type TLSConfig struct {
+	CertFile              string   `yaml:"certFile" toml:"certFile" env:"TLS_CERT_FILE" flag:"tls-cert-file" usage:"TLS 憑證檔（PEM，可含中繼憑證），與金鑰檔皆設定時以 HTTPS 監聽"`
+	KeyFile               string   `yaml:"keyFile" toml:"keyFile" env:"TLS_KEY_FILE" flag:"tls-key-file" usage:"TLS 私鑰檔（PEM）"`
+	RedirectPort          int      `yaml:"redirectPort" toml:"redirectPort" env:"TLS_REDIRECT_PORT" flag:"tls-redirect-port" usage:"另外以此埠接受 HTTP 並轉址到 HTTPS，0 表示停用"`
+	HSTSMaxAge            Duration `yaml:"hstsMaxAge" toml:"hstsMaxAge" env:"TLS_HSTS_MAX_AGE" flag:"tls-hsts-max-age" usage:"HTTPS 回應的 Strict-Transport-Security max-age，0 表示不送出"`
+	HSTSIncludeSubdomains bool     `yaml:"hstsIncludeSubdomains" toml:"hstsIncludeSubdomains" env:"TLS_HSTS_INCLUDE_SUBDOMAINS" flag:"tls-hsts-include-subdomains" usage:"HSTS 是否包含子網域"`
+	HTTP2                 bool     `yaml:"http2" toml:"http2" env:"TLS_HTTP2" flag:"tls-http2" usage:"HTTPS 是否提供 HTTP/2"`
+}
+
+func (c TLSConfig) enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// 部署在 TLS 終止的反向代理之後，或以多個網域對外提供服務
+type ForwardedConfig struct {
+	TrustedProxies string `yaml:"trustedProxies" toml:"trustedProxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies" usage:"信任的前端反向代理 IP 或 CIDR（逗號分隔），只採信來自這些位址的 Forwarded / X-Forwarded-* 標頭"`
+	Hosts          string `yaml:"hosts" toml:"hosts" env:"PUBLIC_HOSTS" flag:"public-hosts" usage:"除 proxyURL 的主機外，另外允許的對外主機名稱（逗號分隔，可含 port）"`
+}
+
+// 轉為 proxy 套件的設定，須先通過 Validate
+func (c ForwardedConfig) policy() proxy.ForwardedPolicy {
+	trusted, _ := proxy.ParseTrustedProxies(rewrite.SplitList(c.TrustedProxies))
+	return proxy.ForwardedPolicy{
+		TrustedProxies: trusted,
+		Hosts:          rewrite.SplitList(c.Hosts),
+	}
+}
+
+type UpstreamConfig struct {
+	Timeout        Duration `yaml:"timeout" toml:"timeout" env:"UPSTREAM_TIMEOUT" flag:"upstream-timeout" usage:"單次上游請求逾時"`
+	Retries        int      `yaml:"retries" toml:"retries" env:"UPSTREAM_RETRIES" flag:"upstream-retries" usage:"冪等請求的最大重試次數"`
+	RetryBaseDelay Duration `yaml:"retryBaseDelay" toml:"retryBaseDelay" env:"UPSTREAM_RETRY_BASE_DELAY" flag:"upstream-retry-base-delay" usage:"重試指數退避的基礎延遲"`
+	RetryMaxDelay  Duration `yaml:"retryMaxDelay" toml:"retryMaxDelay" env:"UPSTREAM_RETRY_MAX_DELAY" flag:"upstream-retry-max-delay" usage:"單次退避延遲上限"`
+	StatusTTL      Duration `yaml:"statusTTL" toml:"statusTTL" env:"UPSTREAM_STATUS_TTL" flag:"upstream-status-ttl" usage:"/_proxy/upstream-status 探測結果的快取時間"`
+}
+
+type BreakerConfig struct {
+	Threshold    float64  `yaml:"threshold" toml:"threshold" env:"BREAKER_THRESHOLD" flag:"breaker-threshold" usage:"統計窗內失敗率達此比例即開啟斷路器 (0-1]"`
+	MinRequests  int      `yaml:"minRequests" toml:"minRequests" env:"BREAKER_MIN_REQUESTS" flag:"breaker-min-requests" usage:"統計窗內至少需有的請求數"`
+	Window       Duration `yaml:"window" toml:"window" env:"BREAKER_WINDOW" flag:"breaker-window" usage:"失敗率統計窗"`
+	OpenDuration Duration `yaml:"openDuration" toml:"openDuration" env:"BREAKER_OPEN_DURATION" flag:"breaker-open-duration" usage:"斷路器開啟後多久進入半開狀態"`
+	HalfOpenMax  int      `yaml:"halfOpenMax" toml:"halfOpenMax" env:"BREAKER_HALF_OPEN_MAX" flag:"breaker-half-open-max" usage:"半開狀態允許同時進行的探測請求數"`
+}
+
+type MaintenanceConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled" env:"MAINTENANCE_MODE" flag:"maintenance" usage:"強制開啟維護模式"`
+	File    string `yaml:"file" toml:"file" env:"MAINTENANCE_FILE" flag:"maintenance-file" usage:"此檔案存在時即進入維護模式"`
+}
+
+type TracingConfig struct {
+	Exporter    string `yaml:"exporter" toml:"exporter" env:"OTEL_TRACES_EXPORTER" flag:"tracing-exporter" usage:"追蹤匯出方式：otlp、stdout、file 或 none"`
+	Endpoint    string `yaml:"endpoint" toml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" flag:"tracing-endpoint" usage:"OTLP/HTTP collector 基底位址，span 送往其下的 /v1/traces"`
+	Headers     string `yaml:"headers" toml:"headers" env:"OTEL_EXPORTER_OTLP_HEADERS" flag:"tracing-headers" usage:"送往 collector 的額外標頭（key=value,...）" secret:"true"`
+	File        string `yaml:"file" toml:"file" env:"OTEL_TRACES_FILE" flag:"tracing-file" usage:"file 匯出器的輸出檔案"`
+	ServiceName string `yaml:"serviceName" toml:"serviceName" env:"OTEL_SERVICE_NAME" flag:"tracing-service-name" usage:"追蹤資料中的服務名稱"`
+}
+
+type AssetsConfig struct {
+	Dir string `yaml:"dir" toml:"dir" env:"ASSETS_DIR" flag:"assets-dir" usage:"注入資源覆寫目錄，檔案變動時自動重新載入"`
+}
+
+// 可透過 SIGHUP 重新載入的網址改寫規則（僅能由設定檔指定）
+type RewriteConfig struct {
+	Rules []RewriteRule `yaml:"rules" toml:"rules"`
+}
+
+// 將頁面中的上游網址 From 改寫為「代理網址 + To」
+type RewriteRule = rewrite.Rule
+
+// 上游 Set-Cookie 的改寫規則（僅能由設定檔指定）
+type CookiesConfig struct {
+	Policies []CookiePolicy `yaml:"policies" toml:"policies"`
+}
+
+// 依 cookie 名稱改寫 Domain、Path、SameSite、Secure、HttpOnly 與 Partitioned
+type CookiePolicy = cookies.Policy
+
+// 代理產生的 HTML 頁面加上的安全性標頭，留空則不送出該標頭
+type SecurityConfig struct {
+	CSP                string `yaml:"csp" toml:"csp" env:"SECURITY_CSP" flag:"security-csp" usage:"Content-Security-Policy，{nonce} 會替換為注入的 style/script 所用的 nonce" clearable:"true"`
+	CSPReportOnly      string `yaml:"cspReportOnly" toml:"cspReportOnly" env:"SECURITY_CSP_REPORT_ONLY" flag:"security-csp-report-only" usage:"Content-Security-Policy-Report-Only，{nonce} 同上；預設以 nonce 試行 script-src / style-src" clearable:"true"`
+	FrameOptions       string `yaml:"frameOptions" toml:"frameOptions" env:"SECURITY_FRAME_OPTIONS" flag:"security-frame-options" usage:"X-Frame-Options（SAMEORIGIN 或留空），frameset 需要框住同源頁面" clearable:"true"`
+	ContentTypeOptions string `yaml:"contentTypeOptions" toml:"contentTypeOptions" env:"SECURITY_CONTENT_TYPE_OPTIONS" flag:"security-content-type-options" usage:"X-Content-Type-Options" clearable:"true"`
+	ReferrerPolicy     string `yaml:"referrerPolicy" toml:"referrerPolicy" env:"SECURITY_REFERRER_POLICY" flag:"security-referrer-policy" usage:"Referrer-Policy" clearable:"true"`
+	PermissionsPolicy  string `yaml:"permissionsPolicy" toml:"permissionsPolicy" env:"SECURITY_PERMISSIONS_POLICY" flag:"security-permissions-policy" usage:"Permissions-Policy" clearable:"true"`
+}
+
+func newSecurityConfig(headers proxy.SecurityHeaders) SecurityConfig {
+	return SecurityConfig{
+		CSP:                headers.CSP,
+		CSPReportOnly:      headers.CSPReportOnly,
+		FrameOptions:       headers.FrameOptions,
+		ContentTypeOptions: headers.ContentTypeOptions,
+		ReferrerPolicy:     headers.ReferrerPolicy,
+		PermissionsPolicy:  headers.PermissionsPolicy,
+	}
+}
+
+func (c SecurityConfig) headers() proxy.SecurityHeaders {
+	return proxy.SecurityHeaders{
+		CSP:                c.CSP,
+		CSPReportOnly:      c.CSPReportOnly,
+		FrameOptions:       c.FrameOptions,
+		ContentTypeOptions: c.ContentTypeOptions,
+		ReferrerPolicy:     c.ReferrerPolicy,
+		PermissionsPolicy:  c.PermissionsPolicy,
+	}
+}
+
+// 可透過 SIGHUP 重新載入的 CORS 設定
+type CORSConfig struct {
+	AllowedOrigins string   `yaml:"allowedOrigins" toml:"allowedOrigins" env:"CORS_ALLOWED_ORIGINS" flag:"cors-allowed-origins" usage:"允許的來源（逗號分隔），* 表示回應任何來源"`
+	AllowMethods   string   `yaml:"allowMethods" toml:"allowMethods" env:"CORS_ALLOW_METHODS" flag:"cors-allow-methods" usage:"Access-Control-Allow-Methods"`
+	AllowHeaders   string   `yaml:"allowHeaders" toml:"allowHeaders" env:"CORS_ALLOW_HEADERS" flag:"cors-allow-headers" usage:"Access-Control-Allow-Headers"`
+	ExposeHeaders  string   `yaml:"exposeHeaders" toml:"exposeHeaders" env:"CORS_EXPOSE_HEADERS" flag:"cors-expose-headers" usage:"Access-Control-Expose-Headers"`
+	MaxAge         Duration `yaml:"maxAge" toml:"maxAge" env:"CORS_MAX_AGE" flag:"cors-max-age" usage:"預檢請求快取時間"`
+}
+
+// 可透過 SIGHUP 重新載入的頁面轉換器開關
+type TransformersConfig struct {
+	Enable  string `yaml:"enable" toml:"enable" env:"TRANSFORMERS_ENABLE" flag:"transformers-enable" usage:"額外啟用的頁面轉換器（逗號分隔），用於預設停用者"`
+	Disable string `yaml:"disable" toml:"disable" env:"TRANSFORMERS_DISABLE" flag:"transformers-disable" usage:"停用的頁面轉換器（逗號分隔）"`
+}
+
+// JSON API 取得資料的校務系統頁面與課表設定
+type APIConfig struct {
+	GradesPath    string `yaml:"gradesPath" toml:"gradesPath" env:"API_GRADES_PATH" flag:"api-grades-path" usage:"成績查詢頁路徑（/api/v1/grades 的資料來源）"`
+	TimetablePath string `yaml:"timetablePath" toml:"timetablePath" env:"API_TIMETABLE_PATH" flag:"api-timetable-path" usage:"課表頁路徑（/api/v1/timetable 的資料來源）"`
+	Periods       string `yaml:"periods" toml:"periods" env:"API_PERIODS" flag:"api-periods" usage:"節次時間（節次=HH:MM-HH:MM，逗號分隔），頁面未列出上課時間時使用"`
+	SemesterStart string `yaml:"semesterStart" toml:"semesterStart" env:"API_SEMESTER_START" flag:"api-semester-start" usage:"學期第一天（YYYY-MM-DD），課表 iCalendar 匯出使用"`
+	SemesterEnd   string `yaml:"semesterEnd" toml:"semesterEnd" env:"API_SEMESTER_END" flag:"api-semester-end" usage:"學期最後一天（YYYY-MM-DD）"`
+	FeedSecret    string `yaml:"feedSecret" toml:"feedSecret" env:"API_FEED_SECRET" flag:"api-feed-secret" usage:"課表訂閱網址的簽章金鑰，未設定時每次啟動隨機產生" secret:"true"`
+}
+
+// 選單搜尋設定
+type MenuConfig struct {
+	Synonyms string `yaml:"synonyms" toml:"synonyms" env:"MENU_SYNONYMS" flag:"menu-synonyms" usage:"選單搜尋同義詞（分號分隔各組、逗號分隔同組的詞）"`
+}
+
+// 代理端 session store：登入學號對應與常用功能紀錄
+type SessionConfig struct {
+	File          string   `yaml:"file" toml:"file" env:"SESSION_STORE_FILE" flag:"session-store-file" usage:"常用功能與最近使用紀錄的 JSON 檔案，留空則只存在記憶體中"`
+	FlushInterval Duration `yaml:"flushInterval" toml:"flushInterval" env:"SESSION_FLUSH_INTERVAL" flag:"session-flush-interval" usage:"定期寫回 session store 檔案的間隔"`
+	LoginPaths    string   `yaml:"loginPaths" toml:"loginPaths" env:"SESSION_LOGIN_PATHS" flag:"session-login-paths" usage:"登入表單送出的路徑（逗號分隔），只從送往這些路徑的表單取出學號"`
+	LoginFields   string   `yaml:"loginFields" toml:"loginFields" env:"SESSION_LOGIN_FIELDS" flag:"session-login-fields" usage:"登入表單中代表學號的欄位名稱（逗號分隔，依序尋找）"`
+}
+
+// 上游要求從首頁進入時，自動造訪首頁後重送原請求一次
+type WarmUpConfig struct {
+	Markers   string `yaml:"markers" toml:"markers" env:"WARMUP_MARKERS" flag:"warmup-markers" usage:"視為需要先造訪首頁的回應內容（逗號分隔，不分大小寫），留空則停用"`
+	Bootstrap string `yaml:"bootstrap" toml:"bootstrap" env:"WARMUP_BOOTSTRAP" flag:"warmup-bootstrap" usage:"依序造訪的首頁與 frameset 頁面路徑（逗號分隔），每一頁以前一頁作為 Referer"`
+}
+
+func (c WarmUpConfig) policy() proxy.WarmUpPolicy {
+	return proxy.WarmUpPolicy{
+		Markers:   rewrite.SplitList(c.Markers),
+		Bootstrap: rewrite.SplitList(c.Bootstrap),
+	}
+}
+
+// 判斷上游登入狀態的依據
+type LoginConfig struct {
+	Markers         string `yaml:"markers" toml:"markers" env:"LOGIN_MARKERS" flag:"login-markers" usage:"回應內容出現即視為未登入或 session 過期的字串（逗號分隔，不分大小寫）"`
+	RedirectTargets string `yaml:"redirectTargets" toml:"redirectTargets" env:"LOGIN_REDIRECT_TARGETS" flag:"login-redirect-targets" usage:"被重定向到路徑包含這些字串的頁面即視為 session 過期（逗號分隔）"`
+}
+
+func (c LoginConfig) detector() proxy.LoginDetector {
+	return proxy.LoginDetector{
+		Markers:         rewrite.SplitList(c.Markers),
+		RedirectTargets: rewrite.SplitList(c.RedirectTargets),
+	}
+}
+
+// 保持上游 session 不逾時（預設停用）
+type KeepAliveConfig struct {
+	Enabled        bool     `yaml:"enabled" toml:"enabled" env:"KEEPALIVE_ENABLED" flag:"keepalive" usage:"分頁開啟時定期以訪客的 session 請求上游，避免填寫長表單時逾時"`
+	Path           string   `yaml:"path" toml:"path" env:"KEEPALIVE_PATH" flag:"keepalive-path" usage:"保持連線時請求的上游輕量頁面路徑"`
+	Interval       Duration `yaml:"interval" toml:"interval" env:"KEEPALIVE_INTERVAL" flag:"keepalive-interval" usage:"同一 session 兩次向上游請求的最短間隔"`
+	MaxIdle        Duration `yaml:"maxIdle" toml:"maxIdle" env:"KEEPALIVE_MAX_IDLE" flag:"keepalive-max-idle" usage:"最後一次實際操作後最多保持連線多久"`
+	RatePerMinute  int      `yaml:"ratePerMinute" toml:"ratePerMinute" env:"KEEPALIVE_RATE_PER_MINUTE" flag:"keepalive-rate-per-minute" usage:"全站每分鐘最多向上游發出的保持連線請求數"`
+	SessionTimeout Duration `yaml:"sessionTimeout" toml:"sessionTimeout" env:"KEEPALIVE_SESSION_TIMEOUT" flag:"keepalive-session-timeout" usage:"上游 session 閒置逾時時間，用於估計剩餘時間"`
+	WarnBefore     Duration `yaml:"warnBefore" toml:"warnBefore" env:"KEEPALIVE_WARN_BEFORE" flag:"keepalive-warn-before" usage:"剩餘時間少於此值時在頁面顯示逾時警告"`
+}
+
+func newKeepAliveConfig(policy proxy.KeepAlivePolicy) KeepAliveConfig {
+	return KeepAliveConfig{
+		Enabled:        policy.Enabled,
+		Path:           policy.Path,
+		Interval:       Duration(policy.Interval),
+		MaxIdle:        Duration(policy.MaxIdle),
+		RatePerMinute:  policy.RatePerMinute,
+		SessionTimeout: Duration(policy.SessionTimeout),
+		WarnBefore:     Duration(policy.WarnBefore),
+	}
+}
+
+func (c KeepAliveConfig) policy() proxy.KeepAlivePolicy {
+	return proxy.KeepAlivePolicy{
+		Enabled:        c.Enabled,
+		Path:           c.Path,
+		Interval:       time.Duration(c.Interval),
+		MaxIdle:        time.Duration(c.MaxIdle),
+		RatePerMinute:  c.RatePerMinute,
+		SessionTimeout: time.Duration(c.SessionTimeout),
+		WarnBefore:     time.Duration(c.WarnBefore),
+	}
+}
+
+// 功能深層連結 /go/<功能代碼>
+type GoConfig struct {
+	Functions string `yaml:"functions" toml:"functions" env:"GO_FUNCTIONS" flag:"go-functions" usage:"不符合命名慣例的功能代碼對應頁面（代碼=/路徑，分號分隔）"`
+}
+
+// 功能代碼對應表，須先通過 Validate
+func (c GoConfig) paths() map[string]string {
+	paths, _ := proxy.ParseFunctionPaths(c.Functions)
+	return paths
+}
+
+// 轉為 api 套件的設定，須先通過 Validate
+func (c APIConfig) config() api.Config {
+	periods, _ := portal.ParsePeriodTimes(c.Periods)
+	start, _ := parseDate(c.SemesterStart)
+	end, _ := parseDate(c.SemesterEnd)
+	return api.Config{
+		Paths: api.Paths{
+			Grades:    c.GradesPath,
+			Timetable: c.TimetablePath,
+		},
+		Periods:    periods,
+		Semester:   portal.Semester{Start: start, End: end},
+		FeedSecret: c.FeedSecret,
+	}
+}
+
+// 解析 YYYY-MM-DD，空字串為零值
+func parseDate(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(time.DateOnly, raw, portal.Taipei)
+}
+
+func newCORSConfig(policy proxy.CORSPolicy) CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: policy.AllowedOrigins,
+		AllowMethods:   policy.AllowMethods,
+		AllowHeaders:   policy.AllowHeaders,
+		ExposeHeaders:  policy.ExposeHeaders,
+		MaxAge:         Duration(policy.MaxAge),
+	}
+}
+
+func (c CORSConfig) policy() proxy.CORSPolicy {
+	return proxy.CORSPolicy{
+		AllowedOrigins: c.AllowedOrigins,
+		AllowMethods:   c.AllowMethods,
+		AllowHeaders:   c.AllowHeaders,
+		ExposeHeaders:  c.ExposeHeaders,
+		MaxAge:         time.Duration(c.MaxAge),
+	}
+}
+
+func defaultConfig() Config {
+	return Config{
+		Port:      8080,
+		ProxyURL:  "http://127.0.0.1:8080",
+		TargetURL: "https://my.utaipei.edu.tw",
+		Server: ServerConfig{
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		TLS: TLSConfig{
+			HSTSMaxAge: Duration(180 * 24 * time.Hour),
+			HTTP2:      true,
+		},
+		Upstream: UpstreamConfig{
+			Timeout:        Duration(30 * time.Second),
+			Retries:        2,
+			RetryBaseDelay: Duration(200 * time.Millisecond),
+			RetryMaxDelay:  Duration(2 * time.Second),
+			StatusTTL:      Duration(30 * time.Second),
+		},
+		Breaker: BreakerConfig{
+			Threshold:    0.5,
+			MinRequests:  20,
+			Window:       Duration(30 * time.Second),
+			OpenDuration: Duration(30 * time.Second),
+			HalfOpenMax:  3,
+		},
+		Maintenance: MaintenanceConfig{
+			File: "maintenance.flag",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			File:        "traces.json",
+			ServiceName: "better-myUT",
+		},
+		Rewrite: RewriteConfig{
+			Rules: rewrite.DefaultRules(),
+		},
+		CORS: newCORSConfig(proxy.DefaultCORS()),
+		API: APIConfig{
+			GradesPath:    api.DefaultPaths().Grades,
+			TimetablePath: api.DefaultPaths().Timetable,
+			Periods:       portal.DefaultPeriodTimes,
+		},
+		Menu: MenuConfig{
+			Synonyms: menu.DefaultSynonyms,
+		},
+		WarmUp: WarmUpConfig{
+			Markers:   strings.Join(proxy.DefaultWarmUp().Markers, ","),
+			Bootstrap: strings.Join(proxy.DefaultWarmUp().Bootstrap, ","),
+		},
+		Login: LoginConfig{
+			Markers:         strings.Join(proxy.DefaultLoginDetector().Markers, ","),
+			RedirectTargets: strings.Join(proxy.DefaultLoginDetector().RedirectTargets, ","),
+		},
+		Session: SessionConfig{
+			File:          "sessions.json",
+			FlushInterval: Duration(30 * time.Second),
+			LoginPaths:    "/utaipei/perchk.jsp",
+			LoginFields:   "uid,stno,account",
+		},
+		KeepAlive: newKeepAliveConfig(proxy.DefaultKeepAlive()),
+		Cookies: CookiesConfig{
+			Policies: cookies.DefaultPolicies(),
+		},
+		Security: newSecurityConfig(proxy.DefaultSecurityHeaders()),
+	}
+}
+
+// 命令列解析結果
+type cliOptions struct {
+	configFile  string
+	printConfig bool
+	overrides   []flagOverride // 依出現順序記錄的設定覆寫
+	args        []string       // flag 之後的位置參數
+}
+
+type flagOverride struct {
+	name  string
+	value string
+}
+
+// 載入設定：預設值 -> 設定檔 -> 環境變數 -> 命令列參數，最後進行驗證
+func loadConfig(name string, args []string, output io.Writer) (Config, cliOptions, error) {
+	cfg := defaultConfig()
+
+	opts, err := parseFlags(name, args, output)
+	if err != nil {
+		return cfg, opts, err
+	}
+
+	if opts.configFile == "" {
+		opts.configFile = os.Getenv("CONFIG_FILE")
+	}
+	if opts.configFile != "" {
+		if err := loadConfigFile(opts.configFile, &cfg); err != nil {
+			return cfg, opts, err
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, opts, err
+	}
+
+	if err := applyFlagOverrides(&cfg, opts.overrides); err != nil {
+		return cfg, opts, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, opts, err
+	}
+
+	return cfg, opts, nil
+}
+
+// 解析命令列參數；每個設定欄位都會註冊對應的 flag
+func parseFlags(name string, args []string, output io.Writer) (cliOptions, error) {
+	var opts cliOptions
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&opts.configFile, "config", "", "設定檔路徑（.yaml / .yml / .toml），亦可用 CONFIG_FILE 指定")
+	fs.BoolVar(&opts.printConfig, "print-config", false, "印出最終生效的設定（遮蔽機密欄位）後結束")
+
+	defaults := defaultConfig()
+	walkConfigFields(reflect.ValueOf(&defaults).Elem(), func(field reflect.StructField, value reflect.Value) {
+		name := field.Tag.Get("flag")
+		if name == "" {
+			return
+		}
+		usage := field.Tag.Get("usage")
+		if env := field.Tag.Get("env"); env != "" {
+			usage += "（環境變數 " + env + "）"
+		}
+		record := func(s string) error {
+			opts.overrides = append(opts.overrides, flagOverride{name: name, value: s})
+			return nil
+		}
+		if value.Kind() == reflect.Bool {
+			fs.BoolFunc(name, usage, record)
+		} else {
+			fs.Func(name, usage, record)
+		}
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	opts.args = fs.Args()
+	return opts, nil
+}
+
+// 依副檔名讀取 YAML 或 TOML 設定檔，出現未知的鍵時回傳錯誤
+func loadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("讀取設定檔失敗: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("解析設定檔 %s 失敗: %w", path, err)
+		}
+	case ".toml":
+		dec := toml.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			var strictErr *toml.StrictMissingError
+			if errors.As(err, &strictErr) {
+				return fmt.Errorf("設定檔 %s 含有未知的鍵:\n%s", path, strictErr.String())
+			}
+			return fmt.Errorf("解析設定檔 %s 失敗: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("不支援的設定檔格式: %s（僅支援 .yaml、.yml、.toml）", path)
+	}
+	return nil
+}
+
+// 以環境變數覆寫設定
+func applyEnv(cfg *Config) error {
+	var errs []error
+	walkConfigFields(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, value reflect.Value) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if strings.TrimSpace(raw) == "" {
+			if field.Tag.Get("clearable") == "true" && value.Kind() == reflect.String {
+				value.SetString("")
+			}
+			return
+		}
+		if err := setConfigValue(value, strings.TrimSpace(raw)); err != nil {
+			errs = append(errs, fmt.Errorf("環境變數 %s=%q: %w", name, raw, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// 以命令列參數覆寫設定
+func applyFlagOverrides(cfg *Config, overrides []flagOverride) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+
+	fields := map[string]reflect.Value{}
+	walkConfigFields(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, value reflect.Value) {
+		if name := field.Tag.Get("flag"); name != "" {
+			fields[name] = value
+		}
+	})
+
+	var errs []error
+	for _, o := range overrides {
+		if err := setConfigValue(fields[o.name], o.value); err != nil {
+			errs = append(errs, fmt.Errorf("參數 --%s=%q: %w", o.name, o.value, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 走訪所有設定欄位（不含巢狀結構本身）
+func walkConfigFields(v reflect.Value, fn func(reflect.StructField, reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		if value.Kind() == reflect.Struct {
+			walkConfigFields(value, fn)
+			continue
+		}
+		fn(field, value)
+	}
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// 將字串轉成欄位對應的型別
+func setConfigValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("不是合法的時間長度")
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		switch strings.ToLower(raw) {
+		case "1", "true", "yes", "on":
+			v.SetBool(true)
+		case "0", "false", "no", "off":
+			v.SetBool(false)
+		default:
+			return fmt.Errorf("不是合法的布林值")
+		}
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("不是合法的整數")
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("不是合法的數字")
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("不支援的設定型別 %s", v.Kind())
+	}
+	return nil
+}
+
+// 驗證設定，一次回報所有問題
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port 必須介於 1 到 65535，目前為 %d", c.Port))
+	}
+	if err := proxy.ValidateBaseURL("proxyURL", c.ProxyURL); err != nil {
+		errs = append(errs, err)
+	}
+	if err := proxy.ValidateBaseURL("targetURL", c.TargetURL); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, d := range []struct {
+		name  string
+		value Duration
+	}{
+		{"server.shutdownTimeout", c.Server.ShutdownTimeout},
+		{"upstream.timeout", c.Upstream.Timeout},
+		{"upstream.statusTTL", c.Upstream.StatusTTL},
+		{"breaker.window", c.Breaker.Window},
+		{"breaker.openDuration", c.Breaker.OpenDuration},
+		{"session.flushInterval", c.Session.FlushInterval},
+	} {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s 必須大於 0", d.name))
+		}
+	}
+	if c.Upstream.RetryBaseDelay < 0 || c.Upstream.RetryMaxDelay < 0 {
+		errs = append(errs, fmt.Errorf("upstream.retryBaseDelay / retryMaxDelay 不可為負數"))
+	}
+	if c.Upstream.Retries < 0 {
+		errs = append(errs, fmt.Errorf("upstream.retries 不可為負數"))
+	}
+	if c.Breaker.Threshold <= 0 || c.Breaker.Threshold > 1 {
+		errs = append(errs, fmt.Errorf("breaker.threshold 必須介於 0（不含）到 1，目前為 %g", c.Breaker.Threshold))
+	}
+	if c.Breaker.MinRequests < 1 {
+		errs = append(errs, fmt.Errorf("breaker.minRequests 至少為 1"))
+	}
+	if c.Breaker.HalfOpenMax < 1 {
+		errs = append(errs, fmt.Errorf("breaker.halfOpenMax 至少為 1"))
+	}
+
+	c.Tracing.Exporter = strings.ToLower(strings.TrimSpace(c.Tracing.Exporter))
+	switch c.Tracing.Exporter {
+	case "", "none", "otlp", "stdout", "file":
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter 不支援 %q（可用 otlp、stdout、file、none）", c.Tracing.Exporter))
+	}
+	if c.Tracing.Endpoint != "" {
+		if err := proxy.ValidateBaseURL("tracing.endpoint", c.Tracing.Endpoint); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("tls.certFile 與 tls.keyFile 必須同時設定"))
+	}
+	if c.TLS.RedirectPort != 0 {
+		if !c.TLS.enabled() {
+			errs = append(errs, fmt.Errorf("tls.redirectPort 需搭配 tls.certFile 與 tls.keyFile"))
+		}
+		if c.TLS.RedirectPort < 0 || c.TLS.RedirectPort > 65535 || c.TLS.RedirectPort == c.Port {
+			errs = append(errs, fmt.Errorf("tls.redirectPort 必須介於 1-65535 且不可與 port 相同，目前為 %d", c.TLS.RedirectPort))
+		}
+	}
+	if c.TLS.HSTSMaxAge < 0 {
+		errs = append(errs, fmt.Errorf("tls.hstsMaxAge 不可為負數"))
+	}
+	if _, err := proxy.ParseTrustedProxies(rewrite.SplitList(c.Forwarded.TrustedProxies)); err != nil {
+		errs = append(errs, fmt.Errorf("forwarded.trustedProxies: %w", err))
+	}
+	for _, host := range rewrite.SplitList(c.Forwarded.Hosts) {
+		if strings.ContainsAny(host, "/@?#") {
+			errs = append(errs, fmt.Errorf("forwarded.hosts 只能填主機名稱（可含 port），目前為 %q", host))
+		}
+	}
+
+	for i, rule := range c.Rewrite.Rules {
+		if err := proxy.ValidateBaseURL(fmt.Sprintf("rewrite.rules[%d].from", i), rule.From); err != nil {
+			errs = append(errs, err)
+		}
+		if rule.To != "" && (!strings.HasPrefix(rule.To, "/") || strings.HasSuffix(rule.To, "/")) {
+			errs = append(errs, fmt.Errorf("rewrite.rules[%d].to 必須以 / 開頭且不可以 / 結尾，目前為 %q", i, rule.To))
+		}
+	}
+	for i, policy := range c.Cookies.Policies {
+		if err := policy.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("cookies.policies[%d].%w", i, err))
+		}
+	}
+	for _, h := range []struct {
+		name  string
+		value string
+	}{
+		{"security.csp", c.Security.CSP},
+		{"security.cspReportOnly", c.Security.CSPReportOnly},
+		{"security.frameOptions", c.Security.FrameOptions},
+		{"security.contentTypeOptions", c.Security.ContentTypeOptions},
+		{"security.referrerPolicy", c.Security.ReferrerPolicy},
+		{"security.permissionsPolicy", c.Security.PermissionsPolicy},
+	} {
+		if strings.ContainsAny(h.value, "\r\n") {
+			errs = append(errs, fmt.Errorf("%s 不可包含換行", h.name))
+		}
+	}
+	if strings.Contains(strings.ToLower(c.Security.CSP), "frame-ancestors 'none'") {
+		errs = append(errs, fmt.Errorf("security.csp 的 frame-ancestors 不可為 'none'，frameset 需要框住同源頁面（請用 'self'）"))
+	}
+	if fo := strings.ToUpper(c.Security.FrameOptions); fo != "" && fo != "SAMEORIGIN" {
+		errs = append(errs, fmt.Errorf("security.frameOptions 只能為 SAMEORIGIN 或留空（DENY 會讓 frameset 無法顯示），目前為 %q", c.Security.FrameOptions))
+	}
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("cors.maxAge 不可為負數"))
+	}
+	for _, p := range []struct {
+		name  string
+		value string
+	}{
+		{"api.gradesPath", c.API.GradesPath},
+		{"api.timetablePath", c.API.TimetablePath},
+	} {
+		if !strings.HasPrefix(p.value, "/") {
+			errs = append(errs, fmt.Errorf("%s 必須以 / 開頭，目前為 %q", p.name, p.value))
+		}
+	}
+	if _, err := portal.ParsePeriodTimes(c.API.Periods); err != nil {
+		errs = append(errs, fmt.Errorf("api.periods: %w", err))
+	}
+	start, errStart := parseDate(c.API.SemesterStart)
+	end, errEnd := parseDate(c.API.SemesterEnd)
+	if errStart != nil {
+		errs = append(errs, fmt.Errorf("api.semesterStart 必須為 YYYY-MM-DD，目前為 %q", c.API.SemesterStart))
+	}
+	if errEnd != nil {
+		errs = append(errs, fmt.Errorf("api.semesterEnd 必須為 YYYY-MM-DD，目前為 %q", c.API.SemesterEnd))
+	}
+	if errStart == nil && errEnd == nil && !start.IsZero() && !end.IsZero() && end.Before(start) {
+		errs = append(errs, fmt.Errorf("api.semesterEnd 不可早於 api.semesterStart"))
+	}
+	warmUp := c.WarmUp.policy()
+	if len(warmUp.Markers) > 0 && len(warmUp.Bootstrap) == 0 {
+		errs = append(errs, fmt.Errorf("warmUp.bootstrap 不可為空（或清空 warmUp.markers 以停用）"))
+	}
+	for _, path := range warmUp.Bootstrap {
+		if !strings.HasPrefix(path, "/") {
+			errs = append(errs, fmt.Errorf("warmUp.bootstrap 的路徑必須以 / 開頭，目前為 %q", path))
+		}
+	}
+	if _, err := proxy.ParseFunctionPaths(c.Go.Functions); err != nil {
+		errs = append(errs, fmt.Errorf("go.functions: %w", err))
+	}
+	for _, path := range rewrite.SplitList(c.Session.LoginPaths) {
+		if !strings.HasPrefix(path, "/") {
+			errs = append(errs, fmt.Errorf("session.loginPaths 的路徑 %q 必須以 / 開頭", path))
+		}
+	}
+	if len(rewrite.SplitList(c.Session.LoginFields)) == 0 {
+		errs = append(errs, fmt.Errorf("session.loginFields 不可為空"))
+	}
+	if c.KeepAlive.Enabled {
+		if !strings.HasPrefix(c.KeepAlive.Path, "/") {
+			errs = append(errs, fmt.Errorf("keepAlive.path 必須以 / 開頭，目前為 %q", c.KeepAlive.Path))
+		}
+		if c.KeepAlive.Interval <= 0 || c.KeepAlive.MaxIdle <= 0 || c.KeepAlive.SessionTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("keepAlive.interval、maxIdle 與 sessionTimeout 必須大於 0"))
+		} else if c.KeepAlive.Interval >= c.KeepAlive.SessionTimeout {
+			errs = append(errs, fmt.Errorf("keepAlive.interval 必須小於 keepAlive.sessionTimeout，否則無法在逾時前延長"))
+		}
+		if c.KeepAlive.RatePerMinute <= 0 {
+			errs = append(errs, fmt.Errorf("keepAlive.ratePerMinute 必須大於 0"))
+		}
+		if c.KeepAlive.WarnBefore < 0 || c.KeepAlive.WarnBefore >= c.KeepAlive.SessionTimeout {
+			errs = append(errs, fmt.Errorf("keepAlive.warnBefore 必須介於 0 與 keepAlive.sessionTimeout 之間"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("設定驗證失敗:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// 輸出 YAML 格式的設定，機密欄位以星號遮蔽
+func (c Config) WriteMasked(w io.Writer) error {
+	masked := c
+	walkConfigFields(reflect.ValueOf(&masked).Elem(), func(field reflect.StructField, value reflect.Value) {
+		if field.Tag.Get("secret") == "true" && value.Kind() == reflect.String && value.String() != "" {
+			value.SetString("******")
+		}
+	})
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(masked); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,184 @@
+// Package cookies 負責在代理網域與學校網域之間轉換 Set-Cookie。
+//
+// 上游的 Set-Cookie 以 http.ParseSetCookie 解析後，依 cookie 名稱套用宣告式的 Policy
+// 改寫 Domain、Path、SameSite、Secure、HttpOnly 與 Partitioned，再以 http.Cookie 重新輸出，
+// Expires、Max-Age 與加引號的值都會原樣保留。
+package cookies
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 屬性的處理方式
+type Toggle string
+
+const (
+	Keep Toggle = ""    // 保留上游的設定
+	On   Toggle = "on"  // 一律加上
+	Off  Toggle = "off" // 一律移除
+)
+
+// 套用到某個 cookie 的改寫規則
+type Policy struct {
+	Name         string `yaml:"name" toml:"name"`         // cookie 名稱（不分大小寫），* 表示其餘所有 cookie
+	Domain       string `yaml:"domain" toml:"domain"`     // 改寫後的 Domain，空字串表示只限代理主機（host-only）
+	Path         string `yaml:"path" toml:"path"`         // 改寫後的 Path，空字串保留上游的設定
+	SameSite     string `yaml:"sameSite" toml:"sameSite"` // lax、strict 或 none，空字串保留上游的設定
+	Secure       Toggle `yaml:"secure" toml:"secure"`     // 代理網址為 http 時一律移除
+	HttpOnly     Toggle `yaml:"httpOnly" toml:"httpOnly"`
+	Partitioned  Toggle `yaml:"partitioned" toml:"partitioned"`   // CHIPS，需搭配 Secure
+	MirrorDomain string `yaml:"mirrorDomain" toml:"mirrorDomain"` // 另外複製一份到此網域，代理主機不在該網域下時略過
+}
+
+// 預設規則：所有 cookie 改為代理主機的根路徑，上游 session 另外限制為 HttpOnly 與 SameSite=Lax；
+// 代理部署在 utaipei.edu.tw 之下時，另外複製一份讓真正的學校網域也能使用
+func DefaultPolicies() []Policy {
+	return []Policy{
+		{Name: "JSESSIONID", Path: "/", SameSite: "lax", HttpOnly: On, MirrorDomain: ".utaipei.edu.tw"},
+		{Name: "*", Path: "/", MirrorDomain: ".utaipei.edu.tw"},
+	}
+}
+
+// 檢查規則的值是否合法
+func (p Policy) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("name 不可為空")
+	}
+	if _, ok := parseSameSite(p.SameSite); !ok {
+		return fmt.Errorf("sameSite 必須為 lax、strict、none 或留空，目前為 %q", p.SameSite)
+	}
+	for _, t := range []struct {
+		name  string
+		value Toggle
+	}{
+		{"secure", p.Secure},
+		{"httpOnly", p.HttpOnly},
+		{"partitioned", p.Partitioned},
+	} {
+		if t.value != Keep && t.value != On && t.value != Off {
+			return fmt.Errorf("%s 必須為 on、off 或留空，目前為 %q", t.name, t.value)
+		}
+	}
+	if p.Path != "" && !strings.HasPrefix(p.Path, "/") {
+		return fmt.Errorf("path 必須以 / 開頭，目前為 %q", p.Path)
+	}
+	return nil
+}
+
+func parseSameSite(value string) (http.SameSite, bool) {
+	switch strings.ToLower(value) {
+	case "":
+		return 0, true
+	case "lax":
+		return http.SameSiteLaxMode, true
+	case "strict":
+		return http.SameSiteStrictMode, true
+	case "none":
+		return http.SameSiteNoneMode, true
+	}
+	return 0, false
+}
+
+// 依規則將上游回傳的 Set-Cookie 改寫為訪客所用代理網址可用的版本
+type Rewriter struct {
+	policies []Policy
+}
+
+// 建立改寫器；policies 為空時使用 DefaultPolicies，規則須先通過 Validate
+func NewRewriter(policies []Policy) *Rewriter {
+	if len(policies) == 0 {
+		policies = DefaultPolicies()
+	}
+	return &Rewriter{policies: policies}
+}
+
+// 找出 cookie 適用的規則：名稱完全相符者優先，其次為 *；都沒有時回傳空規則（只移除 Domain）
+func (r *Rewriter) policy(name string) Policy {
+	fallback := Policy{}
+	for _, p := range r.policies {
+		if strings.EqualFold(p.Name, name) {
+			return p
+		}
+		if p.Name == "*" {
+			fallback = p
+		}
+	}
+	return fallback
+}
+
+// 改寫一個上游 Set-Cookie 標頭值，publicURL 為訪客所用的代理網址（決定 Secure 與是否複製到其他網域）；
+// 回傳要送給瀏覽器的 Set-Cookie（可能含複製到其他網域的版本），無法解析時丟棄
+func (r *Rewriter) Rewrite(setCookie, publicURL string) []string {
+	cookie, err := http.ParseSetCookie(setCookie)
+	if err != nil {
+		log.Printf("⚠️  無法解析上游 Set-Cookie，已略過: %v", err)
+		return nil
+	}
+	policy := r.policy(cookie.Name)
+
+	host, secure := "", false
+	if u, err := url.Parse(publicURL); err == nil {
+		host, secure = strings.ToLower(u.Hostname()), u.Scheme == "https"
+	}
+
+	out := r.apply(*cookie, policy, policy.Domain, secure)
+	values := []string{out.String()}
+
+	if mirror := policy.MirrorDomain; mirror != "" && withinDomain(host, mirror) {
+		// 學校網域一律使用 https；未指定 SameSite 時使用 None 以便跨子網域使用
+		mirrored := policy
+		mirrored.Secure = On
+		copied := r.apply(*cookie, mirrored, mirror, true)
+		if copied.SameSite == 0 {
+			copied.SameSite = http.SameSiteNoneMode
+		}
+		values = append(values, copied.String())
+	}
+	return values
+}
+
+func (r *Rewriter) apply(c http.Cookie, policy Policy, domain string, secure bool) http.Cookie {
+	c.Domain = strings.TrimPrefix(domain, ".")
+	if policy.Path != "" {
+		c.Path = policy.Path
+	}
+	if sameSite, _ := parseSameSite(policy.SameSite); sameSite != 0 {
+		c.SameSite = sameSite
+	}
+	c.Secure = toggle(policy.Secure, c.Secure)
+	c.HttpOnly = toggle(policy.HttpOnly, c.HttpOnly)
+	c.Partitioned = toggle(policy.Partitioned, c.Partitioned)
+
+	// 經 http 提供的 cookie 不可帶 Secure，瀏覽器也會拒絕沒有 Secure 的 SameSite=None 與 Partitioned
+	if !secure {
+		c.Secure = false
+	}
+	if !c.Secure {
+		if c.SameSite == http.SameSiteNoneMode {
+			c.SameSite = http.SameSiteLaxMode
+		}
+		c.Partitioned = false
+	}
+	c.Raw, c.Unparsed = "", nil
+	return c
+}
+
+func toggle(t Toggle, upstream bool) bool {
+	switch t {
+	case On:
+		return true
+	case Off:
+		return false
+	}
+	return upstream
+}
+
+// 代理主機是否在 domain 之下（瀏覽器只接受這種 Domain 屬性）
+func withinDomain(host, domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
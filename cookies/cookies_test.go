@@ -0,0 +1,159 @@
+package cookies
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRewrite(t *testing.T) {
+	defaults := NewRewriter(nil)
+
+	tests := []struct {
+		name      string
+		rewriter  *Rewriter
+		setCookie string
+		publicURL string
+		want      []string
+	}{
+		{
+			name:      "JSESSIONID 改為代理主機並限制 HttpOnly、SameSite=Lax",
+			rewriter:  defaults,
+			setCookie: "JSESSIONID=abc123; Path=/utaipei; Domain=shcourse.utaipei.edu.tw",
+			publicURL: "https://myut.example.com",
+			want:      []string{"JSESSIONID=abc123; Path=/; HttpOnly; SameSite=Lax"},
+		},
+		{
+			name:      "名稱不分大小寫",
+			rewriter:  defaults,
+			setCookie: "jsessionid=abc123; Path=/utaipei",
+			publicURL: "https://myut.example.com",
+			want:      []string{"jsessionid=abc123; Path=/; HttpOnly; SameSite=Lax"},
+		},
+		{
+			name:      "保留 Expires",
+			rewriter:  defaults,
+			setCookie: "lang=zh-TW; Path=/utaipei; Expires=Wed, 21 Oct 2026 07:28:00 GMT",
+			publicURL: "https://myut.example.com",
+			want:      []string{"lang=zh-TW; Path=/; Expires=Wed, 21 Oct 2026 07:28:00 GMT"},
+		},
+		{
+			name:      "保留 Max-Age",
+			rewriter:  defaults,
+			setCookie: "lang=zh-TW; Max-Age=3600",
+			publicURL: "https://myut.example.com",
+			want:      []string{"lang=zh-TW; Path=/; Max-Age=3600"},
+		},
+		{
+			name:      "Max-Age=0 仍為刪除 cookie",
+			rewriter:  defaults,
+			setCookie: "lang=; Max-Age=0",
+			publicURL: "https://myut.example.com",
+			want:      []string{"lang=; Path=/; Max-Age=0"},
+		},
+		{
+			name:      "加引號的值原樣保留",
+			rewriter:  defaults,
+			setCookie: `pref="a b,c"; Path=/utaipei`,
+			publicURL: "https://myut.example.com",
+			want:      []string{`pref="a b,c"; Path=/`},
+		},
+		{
+			name:      "http 代理網址移除 Secure，SameSite=None 改為 Lax、移除 Partitioned",
+			rewriter:  defaults,
+			setCookie: "track=1; Secure; SameSite=None; Partitioned",
+			publicURL: "http://127.0.0.1:8080",
+			want:      []string{"track=1; Path=/; SameSite=Lax"},
+		},
+		{
+			name:      "https 代理網址保留 Secure、SameSite=None 與 Partitioned",
+			rewriter:  defaults,
+			setCookie: "track=1; Secure; SameSite=None; Partitioned",
+			publicURL: "https://myut.example.com",
+			want:      []string{"track=1; Path=/; Secure; SameSite=None; Partitioned"},
+		},
+		{
+			name:      "代理在學校網域下時另外複製一份",
+			rewriter:  defaults,
+			setCookie: "JSESSIONID=abc123; Path=/utaipei",
+			publicURL: "http://myut.utaipei.edu.tw",
+			want: []string{
+				"JSESSIONID=abc123; Path=/; HttpOnly; SameSite=Lax",
+				"JSESSIONID=abc123; Path=/; Domain=utaipei.edu.tw; HttpOnly; Secure; SameSite=Lax",
+			},
+		},
+		{
+			name:      "複製到學校網域的 cookie 未指定 SameSite 時使用 None",
+			rewriter:  defaults,
+			setCookie: "lang=zh-TW",
+			publicURL: "https://myut.utaipei.edu.tw",
+			want: []string{
+				"lang=zh-TW; Path=/",
+				"lang=zh-TW; Path=/; Domain=utaipei.edu.tw; Secure; SameSite=None",
+			},
+		},
+		{
+			name: "依名稱套用規則，其餘使用 *",
+			rewriter: NewRewriter([]Policy{
+				{Name: "token", Domain: ".example.com", Path: "/api", SameSite: "strict", Secure: On, HttpOnly: On},
+				{Name: "*", HttpOnly: Off},
+			}),
+			setCookie: "token=xyz; Path=/utaipei; HttpOnly",
+			publicURL: "https://myut.example.com",
+			want:      []string{"token=xyz; Path=/api; Domain=example.com; HttpOnly; Secure; SameSite=Strict"},
+		},
+		{
+			name: "* 規則移除 HttpOnly 並保留上游 Path",
+			rewriter: NewRewriter([]Policy{
+				{Name: "token", Path: "/api"},
+				{Name: "*", HttpOnly: Off},
+			}),
+			setCookie: "other=1; Path=/utaipei; HttpOnly",
+			publicURL: "https://myut.example.com",
+			want:      []string{"other=1; Path=/utaipei"},
+		},
+		{
+			name: "沒有相符規則時只移除 Domain",
+			rewriter: NewRewriter([]Policy{
+				{Name: "token", Path: "/api"},
+			}),
+			setCookie: "other=1; Path=/utaipei; Domain=utaipei.edu.tw; Secure",
+			publicURL: "https://myut.example.com",
+			want:      []string{"other=1; Path=/utaipei; Secure"},
+		},
+		{
+			name:      "無法解析時丟棄",
+			rewriter:  defaults,
+			setCookie: "=novalue",
+			publicURL: "https://myut.example.com",
+			want:      nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rewriter.Rewrite(tt.setCookie, tt.publicURL)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rewrite(%q, %q)\n got: %q\nwant: %q", tt.setCookie, tt.publicURL, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		ok     bool
+	}{
+		{Policy{Name: "JSESSIONID", Path: "/", SameSite: "Lax", HttpOnly: On}, true},
+		{Policy{Name: "*", Secure: Off, Partitioned: Keep}, true},
+		{Policy{Name: " "}, false},
+		{Policy{Name: "a", SameSite: "loose"}, false},
+		{Policy{Name: "a", Secure: "yes"}, false},
+		{Policy{Name: "a", Path: "utaipei"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.policy.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v.Validate() = %v, want ok=%v", tt.policy, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package export 將表格資料輸出為 CSV 或 XLSX 檔案。
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 支援的匯出格式
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Excel 依此判斷 CSV 為 UTF-8 編碼
+const utf8BOM = "\uFEFF"
+
+// 各格式的 Content-Type
+var ContentTypes = map[string]string{
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// 依格式輸出表格，header 為 nil 時不輸出表頭列
+func Write(w io.Writer, format, sheetName string, header []string, rows [][]string) error {
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		return CSV(w, header, rows)
+	case FormatXLSX:
+		return XLSX(w, sheetName, header, rows)
+	default:
+		return fmt.Errorf("不支援的匯出格式 %q（可用 csv、xlsx）", format)
+	}
+}
+
+// 試算表會將以這些字元開頭的儲存格當成公式
+const formulaPrefixes = "=+-@\t\r"
+
+// 輸出 UTF-8 CSV，開頭加上 BOM 並以 CRLF 換行，讓 Excel 直接開啟時不會變成亂碼
+//
+// 以公式字元開頭的儲存格前加上 '，避免頁面上的文字在開啟檔案時被當成公式執行。
+func CSV(w io.Writer, header []string, rows [][]string) error {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	if header != nil {
+		if err := cw.Write(escapeFormulas(header)); err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		if err := cw.Write(escapeFormulas(row)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func escapeFormulas(cells []string) []string {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune(formulaPrefixes, rune(cell[0])) {
+			cell = "'" + cell
+		}
+		escaped[i] = cell
+	}
+	return escaped
+}
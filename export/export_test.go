@@ -0,0 +1,112 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+var (
+	testHeader = []string{"學號", "科目名稱", "成績"}
+	testRows   = [][]string{
+		{"0112", "微積分, 一", "85"},
+		{"=HYPERLINK(\"http://evil\")", "+1", "-2"},
+		{"@SUM(A1)", "a=b", ""},
+	}
+)
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := CSV(&buf, testHeader, testRows); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := strings.CutPrefix(buf.String(), utf8BOM)
+	if !ok {
+		t.Fatal("CSV 開頭沒有 UTF-8 BOM")
+	}
+	want := "學號,科目名稱,成績\r\n" +
+		"0112,\"微積分, 一\",85\r\n" +
+		"\"'=HYPERLINK(\"\"http://evil\"\")\",'+1,'-2\r\n" +
+		"'@SUM(A1),a=b,\r\n"
+	if got != want {
+		t.Errorf("CSV()\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := XLSX(&buf, "成績/113:1", testHeader, testRows); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("XLSX 不是有效的 zip：%v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 每個 XML 部件都須能解析
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s 不是有效的 XML：%v", f.Name, err)
+			}
+		}
+		files[f.Name] = string(content)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("XLSX 缺少 %s", name)
+		}
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `name="成績 113 1"`) {
+		t.Errorf("工作表名稱未清除不可用字元：%s", files["xl/workbook.xml"])
+	}
+
+	// 儲存格皆為文字，保留開頭的 0，公式字元原樣保留且不會被當成公式
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref  string `xml:"r,attr"`
+				Type string `xml:"t,attr"`
+				Text string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal([]byte(files["xl/worksheets/sheet1.xml"]), &sheet); err != nil {
+		t.Fatal(err)
+	}
+	if len(sheet.Rows) != 1+len(testRows) {
+		t.Fatalf("工作表有 %d 列, want %d", len(sheet.Rows), 1+len(testRows))
+	}
+	for _, check := range []struct {
+		row, col int
+		ref      string
+		text     string
+	}{
+		{1, 0, "A2", "0112"},
+		{2, 0, "A3", `=HYPERLINK("http://evil")`},
+		{3, 0, "A4", "@SUM(A1)"},
+	} {
+		cell := sheet.Rows[check.row].Cells[check.col]
+		if cell.Ref != check.ref || cell.Type != "inlineStr" || cell.Text != check.text {
+			t.Errorf("儲存格 %s = %+v, want inlineStr %q", check.ref, cell, check.text)
+		}
+	}
+}
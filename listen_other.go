@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// 此平台不支援 SO_REUSEPORT
+func listenReusePort(addr string) (net.Listener, error) {
+	return nil, fmt.Errorf("%s 不支援 SO_REUSEPORT", runtime.GOOS)
+}
@@ -0,0 +1,131 @@
+// Package menu 解析校務系統選單的 HTML 片段，取出功能名稱與功能代碼。
+package menu
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTML 解析請求結構
+type ParseHTMLRequest struct {
+	HTMLElements []HTMLElement `json:"htmlElements"`
+	Type         string        `json:"type"` // "function" 或 "category"
+}
+
+type HTMLElement struct {
+	HTML string `json:"html"`
+}
+
+// HTML 解析回應結構
+type ParseHTMLResponse struct {
+	Items []MenuItem `json:"items"`
+}
+
+type MenuItem struct {
+	Text string `json:"text"`
+	Code string `json:"code,omitempty"`
+	Type string `json:"type"`
+}
+
+// of_display('AG008') 的第一個參數為功能代碼，之後可能另有參數
+var functionCodeRegex = regexp.MustCompile(`of_display\s*\(\s*['"]([^'"]+)['"]\s*[,)]`)
+
+// onclick 中直接寫出的功能頁，例如 'ag_pro/ag008.jsp'、'/utaipei/ag_pro/ag008.jsp?x=1'
+var functionPageRegex = regexp.MustCompile(`(?i)['"](?:\.{0,2}/)*(?:utaipei/)?([a-z0-9]+_pro/[a-z0-9_]+\.jsp(?:\?[^'"]*)?)['"]`)
+
+// 解析選單 HTML 片段，回傳有文字（功能項目另需有代碼）的項目
+func Parse(req ParseHTMLRequest) []MenuItem {
+	var items []MenuItem
+
+	for i, element := range req.HTMLElements {
+		log.Printf("🔧 解析元素 %d: %s...", i+1, element.HTML[:min(100, len(element.HTML))])
+
+		// 解析 HTML
+		doc, err := html.Parse(strings.NewReader(element.HTML))
+		if err != nil {
+			log.Printf("❌ HTML 解析失敗: %v", err)
+			continue
+		}
+
+		// 提取文字和代碼
+		text := ExtractText(doc)
+		var code string
+		if req.Type == "function" {
+			code = ExtractCode(element.HTML)
+		}
+
+		log.Printf("✅ 解析結果 - 文字: \"%s\", 代碼: \"%s\"", text, code)
+
+		if text != "" && (req.Type == "category" || code != "") {
+			items = append(items, MenuItem{
+				Text: text,
+				Code: code,
+				Type: req.Type,
+			})
+		}
+	}
+
+	return items
+}
+
+// HTML 解析處理函數（POST /api/parse-html）
+func Handler(w http.ResponseWriter, r *http.Request) {
+	var req ParseHTMLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "無效的請求格式"})
+		return
+	}
+
+	log.Printf("🔧 收到 HTML 解析請求，類型: %s，元素數量: %d", req.Type, len(req.HTMLElements))
+
+	items := Parse(req)
+
+	log.Printf("📋 成功解析 %d 個項目", len(items))
+
+	writeJSON(w, http.StatusOK, ParseHTMLResponse{Items: items})
+}
+
+// 提取 HTML 中的純文字
+func ExtractText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return strings.TrimSpace(n.Data)
+	}
+
+	var texts []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if text := ExtractText(c); text != "" {
+			texts = append(texts, text)
+		}
+	}
+
+	return strings.Join(texts, " ")
+}
+
+// 從 HTML 字串中提取代碼
+func ExtractCode(htmlStr string) string {
+	matches := functionCodeRegex.FindStringSubmatch(htmlStr)
+	if len(matches) > 1 {
+		return matches[1]
+	}
+	return ""
+}
+
+// 從 onclick 中提取功能頁路徑（/utaipei/xx_pro/xxx.jsp），沒有寫出路徑時回傳空字串
+func ExtractPage(onclick string) string {
+	matches := functionPageRegex.FindStringSubmatch(onclick)
+	if len(matches) > 1 {
+		return "/utaipei/" + matches[1]
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
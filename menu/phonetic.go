@@ -0,0 +1,183 @@
+package menu
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+)
+
+// 單一字的讀音：各個可能讀音的拼音（不含聲調）與對應的注音首個符號
+type reading struct {
+	pinyin []string
+	zhuyin []rune
+}
+
+var pinyinArgs = func() pinyin.Args {
+	args := pinyin.NewArgs()
+	args.Style = pinyin.Normal
+	args.Heteronym = true
+	return args
+}()
+
+// 拼音聲母對應的注音符號，依長度由長到短比對（zh 要先於 z）
+var zhuyinInitials = []struct {
+	pinyin string
+	zhuyin rune
+}{
+	{"zh", 'ㄓ'}, {"ch", 'ㄔ'}, {"sh", 'ㄕ'},
+	{"b", 'ㄅ'}, {"p", 'ㄆ'}, {"m", 'ㄇ'}, {"f", 'ㄈ'},
+	{"d", 'ㄉ'}, {"t", 'ㄊ'}, {"n", 'ㄋ'}, {"l", 'ㄌ'},
+	{"g", 'ㄍ'}, {"k", 'ㄎ'}, {"h", 'ㄏ'},
+	{"j", 'ㄐ'}, {"q", 'ㄑ'}, {"x", 'ㄒ'},
+	{"r", 'ㄖ'}, {"z", 'ㄗ'}, {"c", 'ㄘ'}, {"s", 'ㄙ'},
+	// 零聲母：以韻母的第一個注音符號為首
+	{"yu", 'ㄩ'}, {"yi", 'ㄧ'}, {"y", 'ㄧ'}, {"wu", 'ㄨ'}, {"w", 'ㄨ'},
+	{"ai", 'ㄞ'}, {"ei", 'ㄟ'}, {"ao", 'ㄠ'}, {"ou", 'ㄡ'},
+	{"ang", 'ㄤ'}, {"eng", 'ㄥ'}, {"an", 'ㄢ'}, {"en", 'ㄣ'}, {"er", 'ㄦ'},
+	{"a", 'ㄚ'}, {"o", 'ㄛ'}, {"e", 'ㄜ'},
+}
+
+// 注音的聲調符號，查詢時忽略
+const zhuyinTones = "ˊˇˋ˙"
+
+// 取得字串中每個字的讀音；英數字以自身小寫作為讀音，其餘符號略過
+func readings(s string) []reading {
+	var result []reading
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			syllables := pinyin.SinglePinyin(r, pinyinArgs)
+			if len(syllables) == 0 {
+				continue
+			}
+			rd := reading{pinyin: syllables}
+			for _, syllable := range syllables {
+				if z := zhuyinInitial(syllable); z != 0 {
+					rd.zhuyin = append(rd.zhuyin, z)
+				}
+			}
+			result = append(result, rd)
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			result = append(result, reading{pinyin: []string{strings.ToLower(string(r))}})
+		}
+	}
+	return result
+}
+
+func zhuyinInitial(syllable string) rune {
+	// 拼音中 ü 以 v 表示
+	syllable = strings.ReplaceAll(syllable, "ü", "v")
+	for _, m := range zhuyinInitials {
+		if strings.HasPrefix(syllable, m.pinyin) {
+			return m.zhuyin
+		}
+	}
+	return 0
+}
+
+// 查詢是否全為拼音字母
+func isPinyinQuery(q string) bool {
+	if q == "" {
+		return false
+	}
+	for _, r := range q {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// 取出查詢中的注音符號（忽略聲調與空白），查詢含其他字元時回傳 nil
+func zhuyinQuery(q string) []rune {
+	var symbols []rune
+	for _, r := range q {
+		switch {
+		case r >= 'ㄅ' && r <= 'ㄩ':
+			symbols = append(symbols, r)
+		case strings.ContainsRune(zhuyinTones, r) || unicode.IsSpace(r):
+		default:
+			return nil
+		}
+	}
+	return symbols
+}
+
+// 以拼音比對：查詢須能依序切成連續數個字讀音的前綴，例如 "cj"、"chengji"、"chji" 都對應「成績」
+//
+// 回傳比對到的起始字位置，找不到時回傳 -1。
+func matchPinyin(q string, rds []reading) int {
+	m := pinyinMatcher{q: q, rds: rds, memo: make([]int8, (len(q)+1)*(len(rds)+1))}
+	for start := range rds {
+		if m.from(0, start) {
+			return start
+		}
+	}
+	return -1
+}
+
+// 拼音比對的回溯狀態，以（查詢位置, 字位置）記錄已算過的結果，避免多音字造成指數級回溯
+type pinyinMatcher struct {
+	q    string
+	rds  []reading
+	memo []int8 // 0 未計算、1 符合、-1 不符合
+}
+
+// q[pos:] 是否能由 rds[i:] 開頭的連續字的拼音前綴組成
+func (m *pinyinMatcher) from(pos, i int) bool {
+	if pos == len(m.q) {
+		return true
+	}
+	if i == len(m.rds) {
+		return false
+	}
+	key := pos*(len(m.rds)+1) + i
+	if m.memo[key] != 0 {
+		return m.memo[key] > 0
+	}
+
+	matched := false
+search:
+	for _, syllable := range m.rds[i].pinyin {
+		for k := min(len(syllable), len(m.q)-pos); k >= 1; k-- {
+			if m.q[pos:pos+k] == syllable[:k] && m.from(pos+k, i+1) {
+				matched = true
+				break search
+			}
+		}
+	}
+	if matched {
+		m.memo[key] = 1
+	} else {
+		m.memo[key] = -1
+	}
+	return matched
+}
+
+// 以注音首個符號比對連續的字，例如「ㄔㄐ」對應「成績」；回傳起始字位置或 -1
+func matchZhuyin(symbols []rune, rds []reading) int {
+	if len(symbols) == 0 {
+		return -1
+	}
+	for start := 0; start+len(symbols) <= len(rds); start++ {
+		matched := true
+		for i, symbol := range symbols {
+			found := false
+			for _, z := range rds[start+i].zhuyin {
+				if z == symbol {
+					found = true
+					break
+				}
+			}
+			if !found {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return start
+		}
+	}
+	return -1
+}
@@ -0,0 +1,453 @@
+package menu
+
+import (
+	"better-myUT/proxy"
+	"better-myUT/rewrite"
+	"better-myUT/session"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// 最多保留幾份選單索引（不同權限的使用者選單不同）
+const maxIndexes = 64
+
+// 記錄各 session 使用哪一份索引，超過上限或閒置過久時清除
+const (
+	maxSessionIndexes = 10000
+	sessionIndexTTL   = 12 * time.Hour
+)
+
+// 查詢字串長度上限（字元數），避免拼音比對耗時過久
+const maxQueryLength = 32
+
+// 在改寫網址之前讀取選單，此時 onclick 中的 of_display 仍為原樣
+const OrderMenuIndex = proxy.OrderRewriteURLs - 10
+
+// 搜尋結果數量預設值與上限
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// 比對方式與基本分數，分數越高排越前面
+const (
+	byExact     = "exact"
+	byCode      = "code"
+	byPrefix    = "prefix"
+	bySubstring = "substring"
+	byPinyin    = "pinyin"
+	byZhuyin    = "zhuyin"
+	byTypo      = "typo"
+	byFuzzy     = "fuzzy"
+	byPath      = "path"
+)
+
+// 經由同義詞比對到的結果，分數打折
+const synonymWeight = 0.9
+
+// 已建立索引的選單項目
+type indexedEntry struct {
+	Entry
+	text     string // 正規化後的名稱
+	code     string // 小寫的功能代碼
+	path     string // 正規化後的分類路徑
+	readings []reading
+}
+
+// 一份選單的搜尋索引
+type Index struct {
+	entries []indexedEntry
+}
+
+// 由選單項目建立搜尋索引
+func NewIndex(entries []Entry) *Index {
+	idx := &Index{entries: make([]indexedEntry, 0, len(entries))}
+	for _, e := range entries {
+		idx.entries = append(idx.entries, indexedEntry{
+			Entry:    e,
+			text:     normalize(e.Text),
+			code:     strings.ToLower(e.Code),
+			path:     normalize(strings.Join(e.Path, " ")),
+			readings: readings(foldVariants(e.Text)),
+		})
+	}
+	return idx
+}
+
+// 依功能代碼（不分大小寫）找出選單中的功能
+func (idx *Index) Function(code string) (Entry, bool) {
+	code = strings.ToLower(code)
+	for _, e := range idx.entries {
+		if e.Type == "function" && e.code == code {
+			return e.Entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// 搜尋結果
+type Result struct {
+	Entry
+	Score   float64 `json:"score"`
+	MatchBy string  `json:"matchBy"`
+	Synonym string  `json:"synonym,omitempty"` // 經由同義詞比對時實際使用的詞
+}
+
+// 依分數排序回傳符合查詢的項目，同分時功能優先、再依選單順序
+func (idx *Index) Search(query string, synonyms *Synonyms, limit int) []Result {
+	q := normalize(query)
+	if q == "" {
+		return []Result{}
+	}
+
+	type candidate struct {
+		term   string
+		weight float64
+	}
+	candidates := []candidate{{q, 1}}
+	for _, term := range synonyms.Expand(q) {
+		candidates = append(candidates, candidate{term, synonymWeight})
+	}
+
+	type ranked struct {
+		Result
+		order int
+	}
+	var results []ranked
+	for i, e := range idx.entries {
+		best := Result{Entry: e.Entry}
+		for _, c := range candidates {
+			score, by := e.match(c.term)
+			score *= c.weight
+			if score > best.Score {
+				best.Score, best.MatchBy = score, by
+				best.Synonym = ""
+				if c.term != q {
+					best.Synonym = c.term
+				}
+			}
+		}
+		if best.Score > 0 {
+			if e.Type == "function" {
+				best.Score += 1
+			}
+			results = append(results, ranked{Result: best, order: i})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].order < results[j].order
+	})
+
+	out := make([]Result, 0, min(limit, len(results)))
+	for _, r := range results {
+		if len(out) >= limit {
+			break
+		}
+		out = append(out, r.Result)
+	}
+	return out
+}
+
+// 單一項目對查詢詞的分數與比對方式，不符合時分數為 0
+func (e indexedEntry) match(q string) (float64, string) {
+	switch {
+	case e.text == q:
+		return 100, byExact
+	case e.code != "" && e.code == q:
+		return 95, byCode
+	case strings.HasPrefix(e.text, q):
+		return 90, byPrefix
+	case strings.Contains(e.text, q):
+		// 越靠前、佔名稱比例越高越相關
+		pos := utf8.RuneCountInString(e.text[:strings.Index(e.text, q)])
+		return 80 - min(float64(pos), 10) + 5*coverage(q, e.text), bySubstring
+	case e.code != "" && strings.HasPrefix(e.code, q):
+		return 75, byCode
+	}
+
+	if isPinyinQuery(q) && utf8.RuneCountInString(q) >= 2 {
+		if start := matchPinyin(q, e.readings); start >= 0 {
+			return 70 - min(float64(start), 10), byPinyin
+		}
+	}
+	if symbols := zhuyinQuery(q); len(symbols) > 0 {
+		if start := matchZhuyin(symbols, e.readings); start >= 0 {
+			return 68 - min(float64(start), 10), byZhuyin
+		}
+	}
+	if utf8.RuneCountInString(q) >= 3 && oneSubstitution(q, e.text) {
+		return 55, byTypo
+	}
+	if ratio, ok := subsequence(q, e.text); ok && utf8.RuneCountInString(q) >= 2 {
+		return 30 + 20*ratio, byFuzzy
+	}
+	if e.path != "" && strings.Contains(e.path, q) {
+		return 40, byPath
+	}
+	return 0, ""
+}
+
+// 查詢佔名稱的比例
+func coverage(q, text string) float64 {
+	return float64(utf8.RuneCountInString(q)) / float64(max(utf8.RuneCountInString(text), 1))
+}
+
+// 名稱中是否有與查詢等長、只差一個字的片段（打錯一個字）
+func oneSubstitution(q, text string) bool {
+	qr, tr := []rune(q), []rune(text)
+	for start := 0; start+len(qr) <= len(tr); start++ {
+		diff := 0
+		for i := range qr {
+			if qr[i] != tr[start+i] {
+				diff++
+				if diff > 1 {
+					break
+				}
+			}
+		}
+		if diff <= 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// 查詢的字是否依序出現在名稱中（可不相連），回傳查詢佔名稱的比例
+func subsequence(q, text string) (float64, bool) {
+	qr := []rune(q)
+	i := 0
+	for _, r := range text {
+		if i < len(qr) && r == qr[i] {
+			i++
+		}
+	}
+	if i < len(qr) {
+		return 0, false
+	}
+	return coverage(q, text), true
+}
+
+// 正規化：全形轉半形、轉小寫、簡體與異體字轉正體、合併空白
+func normalize(s string) string {
+	s = norm.NFKC.String(s)
+	s = strings.ToLower(foldVariants(s))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// 同義詞組，同一組中的詞可互相替換
+type Synonyms struct {
+	groups [][]string
+}
+
+// 解析同義詞設定：以分號分隔各組、逗號分隔同一組的詞，例如 "成績,分數,GPA;請假,假單"
+func ParseSynonyms(raw string) *Synonyms {
+	s := &Synonyms{}
+	for _, group := range strings.Split(raw, ";") {
+		var terms []string
+		for _, term := range strings.Split(group, ",") {
+			if term = normalize(term); term != "" {
+				terms = append(terms, term)
+			}
+		}
+		if len(terms) >= 2 {
+			s.groups = append(s.groups, terms)
+		}
+	}
+	return s
+}
+
+// 將查詢中出現的同義詞替換為同組的其他詞，回傳所有替換結果
+func (s *Synonyms) Expand(q string) []string {
+	if s == nil {
+		return nil
+	}
+	seen := map[string]bool{q: true}
+	var expanded []string
+	for _, group := range s.groups {
+		for _, term := range group {
+			if !strings.Contains(q, term) {
+				continue
+			}
+			for _, other := range group {
+				if alt := strings.Replace(q, term, other, 1); !seen[alt] {
+					seen[alt] = true
+					expanded = append(expanded, alt)
+				}
+			}
+		}
+	}
+	return expanded
+}
+
+// 預設同義詞
+const DefaultSynonyms = "成績,分數,學期成績,GPA;課表,課程表,上課時間;請假,假單,缺曠;選課,加退選,加選,退選;" +
+	"學費,繳費,繳費單;畢業,畢業審查,畢審;宿舍,住宿;獎學金,助學金;教學評量,期末評量,評鑑"
+
+// 選單搜尋服務：由代理轉送的選單頁建立索引，並依呼叫者的 session 提供搜尋端點
+type Searcher struct {
+	synonyms *Synonyms
+
+	mu       sync.Mutex
+	indexes  map[string]*Index
+	order    []string // 建立順序，超過上限時淘汰最舊的索引
+	sessions map[string]sessionIndex
+}
+
+// session 最近一次看到的選單
+type sessionIndex struct {
+	id       string
+	lastSeen time.Time
+}
+
+func NewSearcher(synonyms *Synonyms) *Searcher {
+	return &Searcher{synonyms: synonyms, indexes: map[string]*Index{}, sessions: map[string]sessionIndex{}}
+}
+
+// 記錄 session 的選單：解析頁面中的選單樹，建立（或沿用內容相同的）索引
+//
+// 索引以選單項目的雜湊為 ID，相同權限的使用者共用同一份。頁面沒有選單項目時回傳 nil。
+func (s *Searcher) Observe(sessionID, page string) (*Index, error) {
+	entries, err := ParseTree(page)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:8])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx, ok := s.indexes[id]
+	if !ok {
+		idx = NewIndex(entries)
+		s.indexes[id] = idx
+		s.order = append(s.order, id)
+		for len(s.order) > maxIndexes {
+			delete(s.indexes, s.order[0])
+			s.order = s.order[1:]
+		}
+		log.Printf("🔎 建立選單索引 %s，共 %d 個項目", id, len(entries))
+	}
+	if sessionID != "" {
+		now := time.Now()
+		if _, exists := s.sessions[sessionID]; !exists && len(s.sessions) >= maxSessionIndexes {
+			s.pruneLocked(now)
+		}
+		s.sessions[sessionID] = sessionIndex{id: id, lastSeen: now}
+	}
+	return idx, nil
+}
+
+// 取得 session 的選單索引；索引已被淘汰或 session 閒置過久時回傳 nil
+func (s *Searcher) sessionIndex(sessionID string) *Index {
+	if sessionID == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.sessions[sessionID]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if now.Sub(entry.lastSeen) > sessionIndexTTL {
+		delete(s.sessions, sessionID)
+		return nil
+	}
+	entry.lastSeen = now
+	s.sessions[sessionID] = entry
+	return s.indexes[entry.id]
+}
+
+// 清除閒置過久的 session；仍超過上限時移除一半
+func (s *Searcher) pruneLocked(now time.Time) {
+	for id, entry := range s.sessions {
+		if now.Sub(entry.lastSeen) > sessionIndexTTL {
+			delete(s.sessions, id)
+		}
+	}
+	for id := range s.sessions {
+		if len(s.sessions) < maxSessionIndexes/2 {
+			break
+		}
+		delete(s.sessions, id)
+	}
+}
+
+// 在代理轉送含選單樹（#m_tree）的頁面時，為訪客的 session 建立選單索引；不修改頁面
+func (s *Searcher) Transformer() rewrite.Transformer {
+	return rewrite.Stage{
+		ID:       "menu-index",
+		Priority: OrderMenuIndex,
+		Matcher:  proxy.HTMLPage,
+		Fn: func(ctx context.Context, page *rewrite.Page) error {
+			if page.Request == nil || !strings.Contains(page.Body, "m_tree") {
+				return nil
+			}
+			_, err := s.Observe(session.ID(page.Request), page.Body)
+			return err
+		},
+	}
+}
+
+// 依呼叫者 session 的選單找出功能代碼對應的功能頁，供 /go/<功能代碼> 使用
+//
+// inMenu 表示選單中有這個功能；選單項目沒有寫出功能頁時 page 為空字串，由呼叫端依命名慣例推得。
+func (s *Searcher) FunctionPage(r *http.Request, code string) (page string, inMenu bool) {
+	idx := s.sessionIndex(session.ID(r))
+	if idx == nil {
+		return "", false
+	}
+	entry, ok := idx.Function(code)
+	if !ok {
+		return "", false
+	}
+	return entry.Page, true
+}
+
+type SearchResponse struct {
+	Query   string   `json:"query"`
+	Results []Result `json:"results"`
+}
+
+// 搜尋呼叫者的選單（GET /api/menu/search?q=&limit=）
+func (s *Searcher) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	if utf8.RuneCountInString(q) > maxQueryLength {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "查詢字串過長"})
+		return
+	}
+
+	idx := s.sessionIndex(session.ID(r))
+	if idx == nil {
+		// 代理尚未轉送過這個 session 的選單（或已重啟），重新整理校務系統頁面後即會建立
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "尚未載入選單，請重新整理頁面"})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 {
+		limit = min(n, maxSearchLimit)
+	}
+	writeJSON(w, http.StatusOK, SearchResponse{Query: q, Results: idx.Search(q, s.synonyms, limit)})
+}
@@ -0,0 +1,116 @@
+package menu
+
+import (
+	"better-myUT/session"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testEntries = []Entry{
+	{Text: "教務系統", Type: "category"},
+	{Text: "學期成績查詢", Code: "AG008", Type: "function", Path: []string{"教務系統"}},
+	{Text: "歷年成績查詢", Code: "AG009", Type: "function", Path: []string{"教務系統"}},
+	{Text: "個人課表查詢", Code: "AG222", Type: "function", Path: []string{"教務系統"}},
+	{Text: "學務系統", Type: "category"},
+	{Text: "請假申請", Code: "SA101", Type: "function", Path: []string{"學務系統"}},
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := NewIndex(testEntries)
+	synonyms := ParseSynonyms(DefaultSynonyms)
+
+	tests := []struct {
+		name    string
+		query   string
+		want    string // 第一筆結果的名稱
+		by      string
+		synonym string
+	}{
+		{name: "完全相符", query: "學期成績查詢", want: "學期成績查詢", by: byExact},
+		{name: "功能代碼不分大小寫", query: "ag222", want: "個人課表查詢", by: byCode},
+		{name: "全形功能代碼", query: "ＡＧ００９", want: "歷年成績查詢", by: byCode},
+		{name: "拼音首字母", query: "cj", want: "學期成績查詢", by: byPinyin},
+		{name: "完整拼音", query: "chengji", want: "學期成績查詢", by: byPinyin},
+		{name: "注音首音", query: "ㄔㄐ", want: "學期成績查詢", by: byZhuyin},
+		{name: "簡體字", query: "课表", want: "個人課表查詢", by: bySubstring},
+		// 「成绩」轉為「成績」後再經同義詞換成「學期成績」，前綴比對分數較高
+		{name: "簡體字經同義詞", query: "成绩", want: "學期成績查詢", by: byPrefix, synonym: "學期成績"},
+		{name: "同義詞", query: "假單", want: "請假申請", by: byPrefix, synonym: "請假"},
+		{name: "打錯一個字", query: "學期成積查詢", want: "學期成績查詢", by: byTypo},
+		{name: "分類路徑", query: "學務", want: "學務系統", by: byPrefix},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := idx.Search(tt.query, synonyms, defaultSearchLimit)
+			if len(results) == 0 {
+				t.Fatalf("Search(%q) 沒有結果", tt.query)
+			}
+			got := results[0]
+			if got.Text != tt.want || got.MatchBy != tt.by || got.Synonym != tt.synonym {
+				t.Errorf("Search(%q)[0] = %s (%s, 同義詞 %q), want %s (%s, 同義詞 %q)",
+					tt.query, got.Text, got.MatchBy, got.Synonym, tt.want, tt.by, tt.synonym)
+			}
+		})
+	}
+}
+
+func TestIndexSearchNoMatch(t *testing.T) {
+	idx := NewIndex(testEntries)
+	for _, q := range []string{"", "   ", "宿舍", "zz"} {
+		if results := idx.Search(q, nil, defaultSearchLimit); len(results) != 0 {
+			t.Errorf("Search(%q) = %d 筆，預期沒有結果", q, len(results))
+		}
+	}
+}
+
+func TestIndexSearchLimit(t *testing.T) {
+	idx := NewIndex(testEntries)
+	results := idx.Search("查詢", nil, 2)
+	if len(results) != 2 {
+		t.Fatalf("Search() 回傳 %d 筆, want 2", len(results))
+	}
+	// 同分時依選單順序
+	if results[0].Text != "學期成績查詢" || results[1].Text != "歷年成績查詢" {
+		t.Errorf("Search() = %s, %s", results[0].Text, results[1].Text)
+	}
+}
+
+func TestSearchHandlerLimit(t *testing.T) {
+	var entries []Entry
+	for i := range maxSearchLimit + 50 {
+		entries = append(entries, Entry{Text: fmt.Sprintf("功能%d查詢", i), Code: fmt.Sprintf("F%03d", i), Type: "function"})
+	}
+	s := NewSearcher(nil)
+	s.indexes["test"] = NewIndex(entries)
+	s.sessions["sid"] = sessionIndex{id: "test", lastSeen: time.Now()}
+
+	tests := []struct {
+		limit string
+		want  int
+	}{
+		{"", defaultSearchLimit},
+		{"5", 5},
+		{"0", defaultSearchLimit},
+		{"abc", defaultSearchLimit},
+		{"1000", maxSearchLimit},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/menu/search?q=查詢&limit="+tt.limit, nil)
+		r.AddCookie(&http.Cookie{Name: session.CookieName, Value: "sid"})
+		w := httptest.NewRecorder()
+		s.SearchHandler(w, r)
+
+		var resp SearchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("limit=%s: 無法解析回應 %q: %v", tt.limit, w.Body.String(), err)
+		}
+		if len(resp.Results) != tt.want {
+			t.Errorf("limit=%s: 回傳 %d 筆, want %d", tt.limit, len(resp.Results), tt.want)
+		}
+	}
+}
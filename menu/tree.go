@@ -0,0 +1,107 @@
+package menu
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 選單樹中的項目，含所在的分類路徑
+type Entry struct {
+	Text string   `json:"text"`
+	Code string   `json:"code,omitempty"`
+	Page string   `json:"page,omitempty"` // onclick 中直接寫出的功能頁路徑
+	Type string   `json:"type"`           // "function" 或 "category"
+	Path []string `json:"path,omitempty"`
+}
+
+// 解析整個選單樹（#m_tree）的 HTML，依文件順序回傳功能與分類項目
+//
+// 功能為 onclick 含 of_display 的 div，分類為 span.shand。分類路徑由外而內：
+// 每一層子項目容器（div）緊接在前的兄弟節點中的 span.shand 即為該層分類。
+func ParseTree(htmlStr string) ([]Entry, error) {
+	doc, err := html.Parse(strings.NewReader(htmlStr))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.DataAtom == atom.Div && strings.Contains(attr(n, "onclick"), "of_display"):
+				if code := ExtractCode(attr(n, "onclick")); code != "" {
+					if text := ExtractText(n); text != "" {
+						entries = append(entries, Entry{Text: text, Code: code, Page: ExtractPage(attr(n, "onclick")), Type: "function", Path: categoryPath(n)})
+					}
+				}
+				return
+			case n.DataAtom == atom.Span && hasClass(n, "shand"):
+				// 「編輯我的最愛」是功能按鈕，不是分類
+				if text := ExtractText(n); text != "" && !strings.Contains(text, "編輯我的最愛") {
+					entries = append(entries, Entry{Text: text, Type: "category", Path: categoryPath(n)})
+				}
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return entries, nil
+}
+
+// 由外而內的分類路徑
+func categoryPath(n *html.Node) []string {
+	var path []string
+	for a := n.Parent; a != nil; a = a.Parent {
+		if a.Type != html.ElementNode || a.DataAtom != atom.Div || attr(a, "id") == "m_tree" {
+			continue
+		}
+		prev := a.PrevSibling
+		for prev != nil && prev.Type != html.ElementNode {
+			prev = prev.PrevSibling
+		}
+		if prev == nil {
+			continue
+		}
+		if category := lastCategory(prev); category != "" {
+			path = append([]string{category}, path...)
+		}
+	}
+	return path
+}
+
+// 節點（含自身）中最後一個 span.shand 的文字
+func lastCategory(n *html.Node) string {
+	if n.Type == html.ElementNode && n.DataAtom == atom.Span && hasClass(n, "shand") {
+		return ExtractText(n)
+	}
+	for c := n.LastChild; c != nil; c = c.PrevSibling {
+		if text := lastCategory(c); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, name := range strings.Fields(attr(n, "class")) {
+		if name == class {
+			return true
+		}
+	}
+	return false
+}
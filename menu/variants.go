@@ -0,0 +1,32 @@
+package menu
+
+import "strings"
+
+// 簡體字與異體字對應到校務系統使用的正體字，兩兩一組（前者轉為後者）
+//
+// 只收錄選單功能名稱中常見的字，不是完整的繁簡轉換表。
+const variantPairs = "" +
+	"学學课課绩績选選资資询詢证證费費缴繳单單务務统統报報计計划劃时時间間师師员員实實习習" +
+	"历歷业業毕畢奖獎贷貸办辦转轉论論问問评評价價数數据據网網络絡机機设設码碼帐帳账帳号號" +
+	"记記录錄总總览覽档檔个個关關于於与與国國际際体體预預约約会會议議补補导導请請旷曠点點" +
+	"类類别別开開门門户戶书書图圖馆館还還续續读讀辅輔双雙规規则則须須讯訊邮郵电電话話联聯" +
+	"纪紀荣榮誉譽惩懲处處进進态態结結测測验驗试試场場发發状狀应應认認访訪况況级級汇匯额額" +
+	"缓緩减減贫貧领領组組织織团團队隊职職称稱岗崗钟鐘节節周週扫掃传傳输輸载載库庫优優审審" +
+	"签簽确確条條项項细細变變换換离離后後复複题題楼樓层層车車诉訴陈陳满滿闻聞静靜财財产產" +
+	"购購买買卖賣销銷药藥医醫疗療险險伤傷调調观觀专專负負责責归歸线線纲綱讲講义義练練赛賽" +
+	"获獲励勵贴貼钱錢银銀" +
+	"台臺裏裡着著峯峰羣群够夠綫線"
+
+var variantReplacer = func() *strings.Replacer {
+	runes := []rune(variantPairs)
+	var oldnew []string
+	for i := 0; i+1 < len(runes); i += 2 {
+		oldnew = append(oldnew, string(runes[i]), string(runes[i+1]))
+	}
+	return strings.NewReplacer(oldnew...)
+}()
+
+// 將簡體與異體字轉為正體字，讓「成绩」、「學期成績」都能對應到相同的字
+func foldVariants(s string) string {
+	return variantReplacer.Replace(s)
+}
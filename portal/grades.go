@@ -0,0 +1,142 @@
+package portal
+
+import (
+	"better-myUT/rewrite"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 單一科目的成績
+type Grade struct {
+	Semester   string   `json:"semester"` // 學年-學期，例如 113-1
+	CourseCode string   `json:"courseCode"`
+	Name       string   `json:"name"`
+	Credits    float64  `json:"credits"`
+	Score      string   `json:"score"`                // 原始成績文字（可能為「通過」、「抵免」等）
+	ScoreValue *float64 `json:"scoreValue,omitempty"` // 成績為數字時的數值
+	Rank       string   `json:"rank,omitempty"`
+}
+
+// 成績表格欄位，依對應優先順序排列（成績先於學期，避免「學期成績」被當成學期欄）
+var gradeColumns = []columnField{
+	{"code", []string{"科目代碼", "課程代碼", "科目代號", "課程代號", "課號", "選課代號", "代碼", "代號"}},
+	{"credits", []string{"學分"}},
+	{"rank", []string{"排名", "名次"}},
+	{"score", []string{"學期成績", "總成績", "最後成績", "成績", "分數"}},
+	{"semester", []string{"學年期", "學期別", "學年學期", "學期", "學年"}},
+	{"name", []string{"科目名稱", "課程名稱", "課名", "科目", "課程"}},
+}
+
+// 平均、總計等非科目的統計列
+var gradeSummaryKeywords = []string{"平均", "合計", "總計", "小計", "總學分", "實得學分"}
+
+// 解析成績查詢頁，回傳所有學期的科目成績（依頁面順序）
+//
+// 頁面中需有同時具備科目名稱與成績欄位的表格；學期依序取自學期欄、
+// 表格內的學期分隔列（例如跨欄的「113學年度第1學期」）、表頭或表格前方的標題文字。
+// 頁面為登入頁時回傳 ErrNotLoggedIn。
+func ParseGrades(page string) ([]Grade, error) {
+	if LoginRequired(page) {
+		return nil, ErrNotLoggedIn
+	}
+
+	tables, err := rewrite.ParseTables(page)
+	if err != nil {
+		return nil, err
+	}
+
+	grades := []Grade{}
+	for _, table := range tables {
+		columns := matchColumns(table.Labels, gradeColumns)
+		if _, ok := columns["name"]; !ok {
+			continue
+		}
+		if _, ok := columns["score"]; !ok {
+			continue
+		}
+
+		semester := tableSemester(table)
+		for _, row := range table.Rows {
+			if s := separatorSemester(row); s != "" {
+				semester = s
+				continue
+			}
+
+			grade := Grade{
+				Semester:   semester,
+				CourseCode: column(row, columns, "code"),
+				Name:       column(row, columns, "name"),
+				Score:      column(row, columns, "score"),
+				Rank:       column(row, columns, "rank"),
+			}
+			if grade.Name == "" || isSummaryRow(row, grade.CourseCode) {
+				continue
+			}
+			if s := NormalizeSemester(column(row, columns, "semester")); s != "" {
+				grade.Semester = s
+			}
+			if credits, ok := parseNumber(column(row, columns, "credits")); ok {
+				grade.Credits = credits
+			}
+			if value, ok := parseNumber(grade.Score); ok && numberRegex.FindString(grade.Score) == strings.TrimSpace(grade.Score) {
+				grade.ScoreValue = &value
+			}
+			grades = append(grades, grade)
+		}
+	}
+	return grades, nil
+}
+
+// 表格本身標示的學期：caption、表頭或表格前方的標題文字
+func tableSemester(table rewrite.Table) string {
+	for c := table.Node.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == atom.Caption {
+			if s := NormalizeSemester(findSemesterText(rewrite.NodeText(c))); s != "" {
+				return s
+			}
+		}
+	}
+	for _, row := range table.Header {
+		for _, text := range row {
+			if s := NormalizeSemester(findSemesterText(text)); s != "" {
+				return s
+			}
+		}
+	}
+	return precedingSemester(table.Node, rewrite.NodeText)
+}
+
+// 只有一格有文字且為學期字樣的分隔列
+func separatorSemester(row []string) string {
+	var only string
+	for _, text := range row {
+		if text == "" {
+			continue
+		}
+		if only != "" {
+			return ""
+		}
+		only = text
+	}
+	return NormalizeSemester(findSemesterText(only))
+}
+
+func isSummaryRow(row []string, code string) bool {
+	if code != "" {
+		return false
+	}
+	for _, text := range row {
+		for _, keyword := range gradeSummaryKeywords {
+			if strings.Contains(text, keyword) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func findSemesterText(text string) string {
+	return semesterTextRegex.FindString(text)
+}
@@ -0,0 +1,114 @@
+package portal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseGrades(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []Grade
+	}{
+		{
+			fixture: "grades_semester.html",
+			want: []Grade{
+				{Semester: "113-1", CourseCode: "1131A0123", Name: "微積分（一）", Credits: 3, Score: "85", ScoreValue: float(85), Rank: "3/52"},
+				{Semester: "113-1", CourseCode: "1131A0456", Name: "程式設計 (一)", Credits: 3, Score: "92.5", ScoreValue: float(92.5), Rank: "1/52"},
+				{Semester: "113-1", CourseCode: "1131B0789", Name: "體育：羽球", Credits: 0, Score: "通過"},
+				{Semester: "113-1", CourseCode: "1131C0012", Name: "通識：藝術與生活", Credits: 2, Score: "停修"},
+			},
+		},
+		{
+			fixture: "grades_history.html",
+			want: []Grade{
+				{Semester: "112-1", CourseCode: "B101", Name: "國文", Credits: 2, Score: "90", ScoreValue: float(90), Rank: "5"},
+				{Semester: "112-1", CourseCode: "B102", Name: "英文（一）", Credits: 2, Score: "77.5", ScoreValue: float(77.5)},
+				{Semester: "112-2", CourseCode: "B201", Name: "英文（二）", Credits: 2, Score: "抵免"},
+				// 學年期欄位優先於分隔列
+				{Semester: "112-3", CourseCode: "S001", Name: "暑修：統計學", Credits: 3, Score: "60", ScoreValue: float(60)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := ParseGrades(readFixture(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("ParseGrades() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseGrades()\n got: %s\nwant: %s", dumpGrades(got), dumpGrades(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseGradesNotLoggedIn(t *testing.T) {
+	for _, page := range []string{
+		readFixture(t, "login.html"),
+		"<html><body>please logon from homepage</body></html>",
+	} {
+		if _, err := ParseGrades(page); !errors.Is(err, ErrNotLoggedIn) {
+			t.Errorf("ParseGrades() error = %v, want ErrNotLoggedIn", err)
+		}
+	}
+}
+
+func TestParseGradesNoTable(t *testing.T) {
+	got, err := ParseGrades("<html><body><p>查無資料</p></body></html>")
+	if err != nil {
+		t.Fatalf("ParseGrades() error = %v", err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("ParseGrades() = %#v，預期空陣列（JSON 為 []）", got)
+	}
+}
+
+func TestNormalizeSemester(t *testing.T) {
+	tests := map[string]string{
+		"113學年度第1學期":    "113-1",
+		"113 學年 第 二 學期": "113-2",
+		"112學年度下學期":     "112-2",
+		"1131":          "113-1",
+		"113-2":         "113-2",
+		"113/1":         "113-1",
+		"99.3":          "99-3",
+		"學期平均":          "",
+		"":              "",
+	}
+	for in, want := range tests {
+		if got := NormalizeSemester(in); got != want {
+			t.Errorf("NormalizeSemester(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func dumpGrades(grades []Grade) string {
+	var s string
+	for _, g := range grades {
+		score := "nil"
+		if g.ScoreValue != nil {
+			score = fmt.Sprint(*g.ScoreValue)
+		}
+		s += fmt.Sprintf("\n  %s %s %s 學分=%v 成績=%s(%s) 排名=%s", g.Semester, g.CourseCode, g.Name, g.Credits, g.Score, score, g.Rank)
+	}
+	return s
+}
@@ -0,0 +1,140 @@
+package portal
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// 學期的上課起訖日期（含當日）
+type Semester struct {
+	Start time.Time
+	End   time.Time
+}
+
+// 課表所用的時區（台灣不實施日光節約時間）
+var Taipei = time.FixedZone("Asia/Taipei", 8*60*60)
+
+const icalTimeLayout = "20060102T150405"
+
+// 將課表輸出為每週重複的 iCalendar 行事曆（RFC 5545）
+//
+// 每門課從學期開始後第一個對應星期起，每週重複到學期結束；沒有上課時間的課程略過。
+func WriteICalendar(w io.Writer, classes []Class, semester Semester, now time.Time) error {
+	var b icalBuilder
+	b.line("BEGIN:VCALENDAR")
+	b.line("VERSION:2.0")
+	b.line("PRODID:-//better-myUT//timetable//ZH-TW")
+	b.line("CALSCALE:GREGORIAN")
+	b.line("METHOD:PUBLISH")
+	b.line("X-WR-CALNAME:" + escapeText("課表"))
+	b.line("X-WR-TIMEZONE:Asia/Taipei")
+	b.line("REFRESH-INTERVAL;VALUE=DURATION:PT12H")
+	b.line("BEGIN:VTIMEZONE")
+	b.line("TZID:Asia/Taipei")
+	b.line("BEGIN:STANDARD")
+	b.line("DTSTART:19700101T000000")
+	b.line("TZOFFSETFROM:+0800")
+	b.line("TZOFFSETTO:+0800")
+	b.line("TZNAME:CST")
+	b.line("END:STANDARD")
+	b.line("END:VTIMEZONE")
+
+	start := dateIn(semester.Start)
+	// UNTIL 須為 UTC，取學期最後一天結束時
+	until := dateIn(semester.End).Add(24*time.Hour - time.Second).UTC()
+	stamp := now.UTC().Format(icalTimeLayout) + "Z"
+
+	for _, class := range classes {
+		begin, okBegin := clockOn(start, class.StartTime)
+		end, okEnd := clockOn(start, class.EndTime)
+		if !okBegin || !okEnd || class.Weekday < 1 || class.Weekday > 7 {
+			continue
+		}
+		offset := (class.Weekday%7 - int(start.Weekday()) + 7) % 7
+		begin = begin.AddDate(0, 0, offset)
+		end = end.AddDate(0, 0, offset)
+		if begin.After(until) {
+			continue
+		}
+
+		description := []string{}
+		if class.Teacher != "" {
+			description = append(description, "教師："+class.Teacher)
+		}
+		if class.CourseCode != "" {
+			description = append(description, "課程代碼："+class.CourseCode)
+		}
+		periods := class.StartPeriod
+		if class.EndPeriod != class.StartPeriod {
+			periods += "-" + class.EndPeriod
+		}
+		description = append(description, "節次："+periods)
+
+		b.line("BEGIN:VEVENT")
+		b.line("UID:" + eventUID(class, semester) + "@better-myUT")
+		b.line("DTSTAMP:" + stamp)
+		b.line("DTSTART;TZID=Asia/Taipei:" + begin.Format(icalTimeLayout))
+		b.line("DTEND;TZID=Asia/Taipei:" + end.Format(icalTimeLayout))
+		b.line("RRULE:FREQ=WEEKLY;UNTIL=" + until.Format(icalTimeLayout) + "Z")
+		b.line("SUMMARY:" + escapeText(class.Course))
+		if class.Room != "" {
+			b.line("LOCATION:" + escapeText(class.Room))
+		}
+		b.line("DESCRIPTION:" + escapeText(strings.Join(description, "\n")))
+		b.line("END:VEVENT")
+	}
+	b.line("END:VCALENDAR")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// 依 RFC 5545 每行不超過 75 位元組、以 CRLF 結尾，折行時不切斷 UTF-8 字元
+type icalBuilder struct {
+	strings.Builder
+}
+
+func (b *icalBuilder) line(s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // 續行開頭的空白也算在內
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
+
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// 同一學期同一時段的課程 UID 固定，重新訂閱時行事曆不會出現重複事件
+func eventUID(class Class, semester Semester) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d|%s|%s|%s",
+		semester.Start.Format("2006-01-02"), class.CourseCode, class.Weekday, class.StartPeriod, class.EndPeriod, class.Course)))
+	return hex.EncodeToString(sum[:8])
+}
+
+func dateIn(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, Taipei)
+}
+
+// 指定日期的 HH:MM
+func clockOn(day time.Time, clock string) (time.Time, bool) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return day.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute), true
+}
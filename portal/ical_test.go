@@ -0,0 +1,98 @@
+package portal
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "以目前輸出覆寫 testdata 中的 golden 檔")
+
+func TestWriteICalendar(t *testing.T) {
+	classes := []Class{
+		// 學期從星期三開始：星期一的課從下週一開始
+		{Course: "微積分（二）", CourseCode: "1132A0123", Teacher: "王大同", Room: "科學館 301", Weekday: 1, StartPeriod: "1", EndPeriod: "2", StartTime: "08:10", EndTime: "10:00"},
+		// 與學期開始同一天
+		{Course: "程式設計", Teacher: "林志明", Room: "資訊館 502", Weekday: 3, StartPeriod: "5", EndPeriod: "6", StartTime: "13:20", EndTime: "15:10"},
+		// 需跳脫的文字，以及超過 75 位元組、須在中文字之間折行的長課名
+		{Course: "專題研究：人工智慧, 機器學習; 與資料科學\\實務應用（跨領域學分學程）", Room: "A棟,B棟", Weekday: 7, StartPeriod: "N", EndPeriod: "N", StartTime: "12:10", EndTime: "13:00"},
+		// 沒有上課時間的課程略過
+		{Course: "另行通知", Weekday: 5, StartPeriod: "8", EndPeriod: "8"},
+	}
+	semester := Semester{
+		Start: time.Date(2025, 9, 10, 0, 0, 0, 0, Taipei),
+		End:   time.Date(2026, 1, 16, 0, 0, 0, 0, Taipei),
+	}
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, Taipei)
+
+	var buf bytes.Buffer
+	if err := WriteICalendar(&buf, classes, semester, now); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	golden := filepath.Join("testdata", "timetable.ics")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := readFixture(t, "timetable.ics"); got != want {
+		t.Errorf("WriteICalendar() 與 %s 不符（以 -update 更新）\n got:\n%s", golden, got)
+	}
+
+	// 與 golden 檔無關的 RFC 5545 規則
+	if !strings.HasSuffix(got, "\r\n") || strings.Contains(strings.ReplaceAll(got, "\r\n", ""), "\n") {
+		t.Error("每行應以 CRLF 結尾")
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("行長 %d 位元組超過 75：%q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("折行切斷了 UTF-8 字元：%q", line)
+		}
+	}
+	for _, want := range []string{
+		"DTSTART;TZID=Asia/Taipei:20250915T081000",
+		"DTSTART;TZID=Asia/Taipei:20250910T132000",
+		"DTSTART;TZID=Asia/Taipei:20250914T121000",
+		"RRULE:FREQ=WEEKLY;UNTIL=20260116T155959Z",
+		"LOCATION:A棟\\,B棟",
+	} {
+		if !strings.Contains(got, want+"\r\n") {
+			t.Errorf("輸出缺少 %q", want)
+		}
+	}
+	if strings.Contains(got, "另行通知") {
+		t.Error("沒有上課時間的課程不應輸出")
+	}
+}
+
+func TestICalLineFolding(t *testing.T) {
+	var b icalBuilder
+	// 73 個 ASCII 字元後接 3 位元組的中文字：第 75 位元組落在字元中間，須提前折行
+	b.line(strings.Repeat("a", 73) + "課表")
+	want := strings.Repeat("a", 73) + "\r\n 課表\r\n"
+	if got := b.String(); got != want {
+		t.Errorf("line() = %q, want %q", got, want)
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := map[string]string{
+		`a,b;c\d`:    `a\,b\;c\\d`,
+		"教師：王\n節次：1": `教師：王\n節次：1`,
+		"行一\r\n行二":   `行一\n行二`,
+	}
+	for in, want := range tests {
+		if got := escapeText(in); got != want {
+			t.Errorf("escapeText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
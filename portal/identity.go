@@ -0,0 +1,35 @@
+package portal
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// 「學號：U11016001」、「學號 U11016001」
+	studentIDRegex = regexp.MustCompile(`學\s*號\s*[:：]?\s*([A-Za-z]?[0-9]{6,10}[A-Za-z]?)`)
+	// 「姓名：王小明」
+	nameLabelRegex = regexp.MustCompile(`姓\s*名\s*[:：]?\s*([\p{Han}·．]{2,10})`)
+	// 「王小明 您好」、「王小明同學」
+	greetingRegex = regexp.MustCompile(`([\p{Han}·．]{2,6})\s*(?:同學\s*)?(?:您好|你好)`)
+	tagRegex      = regexp.MustCompile(`(?s)<script.*?</script>|<style.*?</style>|<[^>]*>`)
+)
+
+// 從頁面（例如首頁 banner）解析登入者的學號與姓名，無法辨識的欄位回傳空字串
+func ParseIdentity(page string) (studentID, name string) {
+	if !strings.Contains(page, "學號") && !strings.Contains(page, "姓名") && !strings.Contains(page, "好") {
+		return "", ""
+	}
+	text := tagRegex.ReplaceAllString(page, " ")
+	text = strings.ReplaceAll(text, "&nbsp;", " ")
+
+	if m := studentIDRegex.FindStringSubmatch(text); m != nil {
+		studentID = strings.ToUpper(m[1])
+	}
+	if m := nameLabelRegex.FindStringSubmatch(text); m != nil {
+		name = m[1]
+	} else if m := greetingRegex.FindStringSubmatch(text); m != nil && !strings.ContainsAny(m[1], "登入系統校務大家") {
+		name = m[1]
+	}
+	return studentID, name
+}
@@ -0,0 +1,128 @@
+// Package portal 將校務系統的頁面解析成結構化資料（成績、課表等）。
+//
+// 校務系統沒有提供 API，各頁面的表格欄位也不完全一致，因此解析器以欄位標題的
+// 關鍵字對應欄位，而不依賴固定的欄位順序。
+package portal
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 頁面為登入頁或要求重新登入，代表使用者的 session 已失效
+var ErrNotLoggedIn = errors.New("尚未登入校務系統或登入已逾時")
+
+var (
+	// 「113學年度第1學期」、「113 學年 第 一 學期」、「113學年度上學期」
+	semesterTextRegex = regexp.MustCompile(`(\d{2,3})\s*學年度?\s*第?\s*([一二三123上下])\s*學期`)
+	// 欄位中常見的「1131」、「113-1」、「113/1」
+	semesterCodeRegex = regexp.MustCompile(`^(\d{2,3})\s*[-/.]?\s*([123])$`)
+
+	numberRegex = regexp.MustCompile(`\d+(?:\.\d+)?`)
+)
+
+// 頁面是否為要求登入的頁面
+func LoginRequired(page string) bool {
+	lower := strings.ToLower(page)
+	if strings.Contains(lower, "please logon from homepage") ||
+		strings.Contains(lower, `type="password"`) ||
+		strings.Contains(lower, "type='password'") ||
+		strings.Contains(lower, "type=password") {
+		return true
+	}
+	return strings.Contains(page, "請重新登入") || strings.Contains(page, "請先登入")
+}
+
+// 將學期文字正規化為「學年-學期」（例如 113-1），無法辨識時回傳空字串
+func NormalizeSemester(text string) string {
+	text = strings.TrimSpace(text)
+	if m := semesterTextRegex.FindStringSubmatch(text); m != nil {
+		term := m[2]
+		switch term {
+		case "一", "上":
+			term = "1"
+		case "二", "下":
+			term = "2"
+		case "三":
+			term = "3"
+		}
+		return m[1] + "-" + term
+	}
+	if m := semesterCodeRegex.FindStringSubmatch(text); m != nil {
+		return m[1] + "-" + m[2]
+	}
+	return ""
+}
+
+// 取出文字中的第一個數字
+func parseNumber(text string) (float64, bool) {
+	m := numberRegex.FindString(text)
+	if m == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(m, 64)
+	return v, err == nil
+}
+
+// 依關鍵字順序為每個欄位找出對應的欄，同一欄不會分配給兩個欄位
+//
+// fields 的順序即優先順序，例如先對應「科目代碼」再對應「科目」，避免名稱欄誤取代碼欄。
+func matchColumns(labels []string, fields []columnField) map[string]int {
+	columns := map[string]int{}
+	used := map[int]bool{}
+	for _, field := range fields {
+	keywords:
+		for _, keyword := range field.keywords {
+			for i, label := range labels {
+				if !used[i] && strings.Contains(label, keyword) {
+					columns[field.name] = i
+					used[i] = true
+					break keywords
+				}
+			}
+		}
+	}
+	return columns
+}
+
+type columnField struct {
+	name     string
+	keywords []string
+}
+
+// 取欄位文字，欄位不存在時回傳空字串
+func column(row []string, columns map[string]int, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
+
+// 表格前方（標題、說明文字）最接近的學期字樣
+//
+// 依序往前找表格的前一個兄弟節點，找不到再往上一層，遇到另一個表格即停止。
+func precedingSemester(table *html.Node, textOf func(*html.Node) string) string {
+	for n := table; n != nil && n.Type != html.DocumentNode; n = n.Parent {
+		for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+			if s.Type == html.ElementNode && s.DataAtom == atom.Table {
+				return ""
+			}
+			text := s.Data
+			if s.Type == html.ElementNode {
+				text = textOf(s)
+			} else if s.Type != html.TextNode {
+				continue
+			}
+			if m := semesterTextRegex.FindAllString(text, -1); len(m) > 0 {
+				return NormalizeSemester(m[len(m)-1])
+			}
+		}
+	}
+	return ""
+}
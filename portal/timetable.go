@@ -0,0 +1,429 @@
+package portal
+
+import (
+	"better-myUT/rewrite"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 一週課表中的一門課（連續節次合併為一筆）
+type Class struct {
+	Course      string `json:"course"`
+	CourseCode  string `json:"courseCode,omitempty"`
+	Teacher     string `json:"teacher,omitempty"`
+	Room        string `json:"room,omitempty"`
+	Weekday     int    `json:"weekday"` // 1 = 星期一 … 7 = 星期日
+	StartPeriod string `json:"startPeriod"`
+	EndPeriod   string `json:"endPeriod"`
+	StartTime   string `json:"startTime,omitempty"` // HH:MM，取自頁面或節次時間設定
+	EndTime     string `json:"endTime,omitempty"`
+}
+
+// 節次的上下課時間
+type PeriodTime struct {
+	Start string // HH:MM
+	End   string
+}
+
+// 節次代號對應的上下課時間
+type PeriodTimes map[string]PeriodTime
+
+// 預設節次時間（「節次=開始-結束」，逗號分隔），可依學校公告以設定覆寫
+const DefaultPeriodTimes = "1=08:10-09:00,2=09:10-10:00,3=10:10-11:00,4=11:10-12:00," +
+	"N=12:10-13:00,5=13:10-14:00,6=14:10-15:00,7=15:10-16:00,8=16:10-17:00,9=17:10-18:00," +
+	"10=18:30-19:20,11=19:25-20:15,12=20:20-21:10,13=21:15-22:05"
+
+var (
+	clockRangeRegex = regexp.MustCompile(`(\d{1,2})\s*[:：]\s*(\d{2})\s*[-~～－至]\s*(\d{1,2})\s*[:：]\s*(\d{2})`)
+	periodRegex     = regexp.MustCompile(`^第?\s*([0-9]{1,2}|[A-Za-z])\s*節?`)
+	periodRangeRx   = regexp.MustCompile(`([0-9]{1,2}|[A-Za-z])\s*[-~～－,、]\s*([0-9]{1,2}|[A-Za-z])`)
+	courseCodeRegex = regexp.MustCompile(`^[A-Za-z0-9]{4,}$`)
+)
+
+var weekdayNames = map[string]int{
+	"一": 1, "二": 2, "三": 3, "四": 4, "五": 5, "六": 6, "日": 7, "天": 7,
+	"mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6, "sun": 7,
+}
+
+// 課表清單格式的欄位，依對應優先順序排列
+var timetableColumns = []columnField{
+	{"code", []string{"科目代碼", "課程代碼", "科目代號", "課程代號", "課號", "選課代號", "代碼", "代號"}},
+	{"weekday", []string{"星期", "上課日", "星期別"}},
+	{"period", []string{"節次", "節"}},
+	{"teacher", []string{"授課教師", "任課教師", "教師", "老師"}},
+	{"room", []string{"教室", "上課地點", "地點"}},
+	{"course", []string{"科目名稱", "課程名稱", "課名", "科目", "課程"}},
+}
+
+// 解析「節次=開始-結束」逗號分隔的設定值
+func ParsePeriodTimes(raw string) (PeriodTimes, error) {
+	periods := PeriodTimes{}
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		code, times, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("節次時間 %q 格式應為 節次=HH:MM-HH:MM", item)
+		}
+		t, ok := parseClockRange(times)
+		if !ok {
+			return nil, fmt.Errorf("節次 %s 的時間 %q 不合法", strings.TrimSpace(code), times)
+		}
+		periods[strings.ToUpper(strings.TrimSpace(code))] = t
+	}
+	return periods, nil
+}
+
+// 解析課表頁，回傳每門課的上課時段（依星期、節次排序）
+//
+// 支援兩種版面：
+//   - 格狀課表：表頭為星期、第一欄為節次（可含上課時間），儲存格以換行分隔課名、教師與教室
+//   - 清單課表：每列一門課，有星期、節次（例如 3-4）、課名、教師、教室欄位
+//
+// 頁面未提供上課時間的節次依 periods 補上；頁面為登入頁時回傳 ErrNotLoggedIn。
+func ParseTimetable(page string, periods PeriodTimes) ([]Class, error) {
+	if LoginRequired(page) {
+		return nil, ErrNotLoggedIn
+	}
+
+	tables, err := rewrite.ParseTables(page)
+	if err != nil {
+		return nil, err
+	}
+
+	classes := []Class{}
+	for _, table := range tables {
+		if weekdays := gridWeekdays(table.Labels); len(weekdays) >= 5 {
+			classes = append(classes, parseTimetableGrid(table, weekdays)...)
+			continue
+		}
+		columns := matchColumns(table.Labels, timetableColumns)
+		_, hasWeekday := columns["weekday"]
+		_, hasPeriod := columns["period"]
+		_, hasCourse := columns["course"]
+		if hasWeekday && hasPeriod && hasCourse {
+			classes = append(classes, parseTimetableList(table, columns)...)
+		}
+	}
+
+	for i := range classes {
+		c := &classes[i]
+		if c.StartTime == "" {
+			c.StartTime = periods[strings.ToUpper(c.StartPeriod)].Start
+		}
+		if c.EndTime == "" {
+			c.EndTime = periods[strings.ToUpper(c.EndPeriod)].End
+		}
+	}
+	sort.SliceStable(classes, func(i, j int) bool {
+		if classes[i].Weekday != classes[j].Weekday {
+			return classes[i].Weekday < classes[j].Weekday
+		}
+		return periodOrder(classes[i].StartPeriod) < periodOrder(classes[j].StartPeriod)
+	})
+	return classes, nil
+}
+
+// 格狀課表表頭中代表星期的欄位（欄位索引 → 星期）
+func gridWeekdays(labels []string) map[int]int {
+	weekdays := map[int]int{}
+	for i, label := range labels {
+		if day := parseWeekday(label); day > 0 {
+			weekdays[i] = day
+		}
+	}
+	return weekdays
+}
+
+// 節次列的節次代號與頁面上的上課時間
+type periodRow struct {
+	code string
+	time PeriodTime
+}
+
+func parseTimetableGrid(table rewrite.Table, weekdays map[int]int) []Class {
+	rows := make([]periodRow, len(table.Rows))
+	for i, row := range table.Rows {
+		for col, text := range row {
+			if _, isDay := weekdays[col]; isDay || text == "" {
+				continue
+			}
+			rows[i].code = parsePeriod(text)
+			rows[i].time, _ = parseClockRange(text)
+			break
+		}
+	}
+
+	var classes []Class
+	for i, cells := range table.Cells {
+		if rows[i].code == "" {
+			continue
+		}
+		for col, cell := range cells {
+			day, ok := weekdays[col]
+			if !ok || cell == nil {
+				continue
+			}
+			lines := cellLines(cell)
+			if len(lines) == 0 {
+				continue
+			}
+
+			end := min(i+rowspan(cell)-1, len(rows)-1)
+			for end > i && rows[end].code == "" {
+				end--
+			}
+			class := classFromLines(lines)
+			class.Weekday = day
+			class.StartPeriod, class.EndPeriod = rows[i].code, rows[end].code
+			class.StartTime, class.EndTime = rows[i].time.Start, rows[end].time.End
+			classes = append(classes, class)
+		}
+	}
+	return mergeAdjacent(classes, rows)
+}
+
+// 合併同一星期、連續節次的同一門課（每節各自一格、沒有用 rowspan 的課表）
+func mergeAdjacent(classes []Class, rows []periodRow) []Class {
+	next := map[string]string{}
+	for i := 0; i+1 < len(rows); i++ {
+		if rows[i].code != "" {
+			for j := i + 1; j < len(rows); j++ {
+				if rows[j].code != "" {
+					next[rows[i].code] = rows[j].code
+					break
+				}
+			}
+		}
+	}
+
+	var merged []Class
+	used := make([]bool, len(classes))
+	for i := range classes {
+		if used[i] {
+			continue
+		}
+		c := classes[i]
+		for extended := true; extended; {
+			extended = false
+			for j := range classes {
+				if !used[j] && j != i && sameClass(c, classes[j]) && c.Weekday == classes[j].Weekday &&
+					next[c.EndPeriod] == classes[j].StartPeriod {
+					c.EndPeriod, c.EndTime = classes[j].EndPeriod, classes[j].EndTime
+					used[j] = true
+					extended = true
+				}
+			}
+		}
+		merged = append(merged, c)
+	}
+	return merged
+}
+
+func parseTimetableList(table rewrite.Table, columns map[string]int) []Class {
+	var classes []Class
+	for _, row := range table.Rows {
+		class := Class{
+			Course:     column(row, columns, "course"),
+			CourseCode: column(row, columns, "code"),
+			Teacher:    column(row, columns, "teacher"),
+			Room:       column(row, columns, "room"),
+			Weekday:    parseWeekday(column(row, columns, "weekday")),
+		}
+		periodText := column(row, columns, "period")
+		if class.Course == "" || class.Weekday == 0 || periodText == "" {
+			continue
+		}
+		if m := periodRangeRx.FindStringSubmatch(periodText); m != nil {
+			class.StartPeriod, class.EndPeriod = strings.ToUpper(m[1]), strings.ToUpper(m[2])
+		} else if code := parsePeriod(periodText); code != "" {
+			class.StartPeriod, class.EndPeriod = code, code
+		} else {
+			continue
+		}
+		if t, ok := parseClockRange(periodText); ok {
+			class.StartTime, class.EndTime = t.Start, t.End
+		}
+		classes = append(classes, class)
+	}
+	return classes
+}
+
+// 由儲存格各行組出課程：依「教師：」「教室：」等標示，否則依序為課名、教師、教室
+func classFromLines(lines []string) Class {
+	var class Class
+	var rest []string
+	for _, line := range lines {
+		key, value, ok := strings.Cut(strings.ReplaceAll(line, "：", ":"), ":")
+		value = strings.TrimSpace(value)
+		switch {
+		case ok && containsAny(key, "教師", "老師"):
+			class.Teacher = value
+		case ok && containsAny(key, "教室", "地點"):
+			class.Room = value
+		case ok && containsAny(key, "課名", "科目", "課程"):
+			class.Course = value
+		case ok && containsAny(key, "代碼", "代號", "課號"):
+			class.CourseCode = value
+		default:
+			rest = append(rest, line)
+		}
+	}
+
+	// 課名前的課程代碼，例如「A1234 微積分」或獨立一行的代碼
+	if len(rest) > 0 && class.CourseCode == "" {
+		if fields := strings.Fields(rest[0]); len(fields) > 1 && courseCodeRegex.MatchString(fields[0]) {
+			class.CourseCode = fields[0]
+			rest[0] = strings.Join(fields[1:], " ")
+		} else if len(rest) > 1 && courseCodeRegex.MatchString(rest[0]) {
+			class.CourseCode, rest = rest[0], rest[1:]
+		}
+	}
+	for _, field := range []*string{&class.Course, &class.Teacher, &class.Room} {
+		if *field == "" && len(rest) > 0 {
+			*field, rest = rest[0], rest[1:]
+		}
+	}
+	return class
+}
+
+func sameClass(a, b Class) bool {
+	return a.Weekday == b.Weekday && a.Course == b.Course && a.CourseCode == b.CourseCode &&
+		a.Teacher == b.Teacher && a.Room == b.Room
+}
+
+// 儲存格內以 <br>、區塊元素分隔的各行文字
+func cellLines(n *html.Node) []string {
+	var lines []string
+	var current strings.Builder
+	flush := func() {
+		if line := strings.Join(strings.Fields(current.String()), " "); line != "" {
+			lines = append(lines, line)
+		}
+		current.Reset()
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			current.WriteString(n.Data)
+			current.WriteByte(' ')
+			return
+		}
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Script, atom.Style, atom.Table:
+				return
+			case atom.Br:
+				flush()
+				return
+			case atom.Div, atom.P, atom.Li:
+				flush()
+				defer flush()
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	flush()
+	return lines
+}
+
+// 由「星期一」、「(一)」、「Mon」等文字取得星期，無法辨識時回傳 0
+func parseWeekday(text string) int {
+	text = strings.TrimSpace(text)
+	for _, prefix := range []string{"星期", "週", "周", "禮拜"} {
+		if rest, ok := strings.CutPrefix(text, prefix); ok {
+			text = rest
+			break
+		}
+	}
+	text = strings.Trim(text, "()（） ")
+	if day, ok := weekdayNames[strings.ToLower(text)]; ok {
+		return day
+	}
+	if len(text) >= 3 {
+		if day, ok := weekdayNames[strings.ToLower(text[:3])]; ok {
+			return day
+		}
+	}
+	// 「一 Mon」這類中英並列的表頭
+	if first, _, ok := strings.Cut(text, " "); ok {
+		if day, ok := weekdayNames[first]; ok {
+			return day
+		}
+	}
+	if n, err := strconv.Atoi(text); err == nil && n >= 1 && n <= 7 {
+		return n
+	}
+	return 0
+}
+
+// 由「第3節」、「3」、「N」等文字取得節次代號
+func parsePeriod(text string) string {
+	if m := periodRegex.FindStringSubmatch(strings.TrimSpace(text)); m != nil {
+		return strings.ToUpper(m[1])
+	}
+	return ""
+}
+
+// 節次排序用：數字依大小，中午等字母節次排在前一節之後
+func periodOrder(code string) float64 {
+	if n, err := strconv.Atoi(code); err == nil {
+		return float64(n)
+	}
+	switch strings.ToUpper(code) {
+	case "N", "Z":
+		return 4.5
+	}
+	return 100
+}
+
+// 「08:10-09:00」、「8：10～9：00」
+func parseClockRange(text string) (PeriodTime, bool) {
+	m := clockRangeRegex.FindStringSubmatch(text)
+	if m == nil {
+		return PeriodTime{}, false
+	}
+	clock := func(h, mm string) (string, bool) {
+		hour, _ := strconv.Atoi(h)
+		minute, _ := strconv.Atoi(mm)
+		if hour > 23 || minute > 59 {
+			return "", false
+		}
+		return fmt.Sprintf("%02d:%02d", hour, minute), true
+	}
+	start, ok1 := clock(m[1], m[2])
+	end, ok2 := clock(m[3], m[4])
+	return PeriodTime{Start: start, End: end}, ok1 && ok2
+}
+
+func rowspan(n *html.Node) int {
+	for _, a := range n.Attr {
+		if a.Key == "rowspan" {
+			if v, err := strconv.Atoi(strings.TrimSpace(a.Val)); err == nil && v > 1 {
+				return v
+			}
+		}
+	}
+	return 1
+}
+
+func containsAny(s string, parts ...string) bool {
+	for _, part := range parts {
+		if strings.Contains(s, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package portal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseTimetable(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []Class
+	}{
+		{
+			fixture: "timetable_grid.html",
+			want: []Class{
+				// rowspan 跨兩節
+				{Course: "微積分（一）", CourseCode: "A0123", Teacher: "王大同", Room: "科學館 301", Weekday: 1, StartPeriod: "1", EndPeriod: "2", StartTime: "08:10", EndTime: "10:00"},
+				// 中午的 N 節
+				{Course: "班會", Teacher: "陳美玲", Weekday: 2, StartPeriod: "N", EndPeriod: "N", StartTime: "12:10", EndTime: "13:00"},
+				// 每節各自一格的連續節次合併為一筆，時間取自頁面
+				{Course: "程式設計", Teacher: "林志明", Room: "資訊館 502", Weekday: 3, StartPeriod: "5", EndPeriod: "6", StartTime: "13:20", EndTime: "15:10"},
+				// 中間隔著 N 節，不合併
+				{Course: "英文（二）", Teacher: "Smith", Room: "語言中心 201", Weekday: 4, StartPeriod: "4", EndPeriod: "4", StartTime: "11:10", EndTime: "12:00"},
+				{Course: "英文（二）", Teacher: "Smith", Room: "語言中心 201", Weekday: 4, StartPeriod: "5", EndPeriod: "5", StartTime: "13:20", EndTime: "14:10"},
+				// rowspan 超出表格時截到最後一節，頁面沒有時間的節次依設定補上
+				{Course: "體育：羽球", Teacher: "張志豪", Room: "體育館", Weekday: 5, StartPeriod: "8", EndPeriod: "8", StartTime: "16:10", EndTime: "17:00"},
+			},
+		},
+		{
+			fixture: "timetable_list.html",
+			want: []Class{
+				{Course: "微積分（二）", CourseCode: "1132A0123", Teacher: "王大同", Room: "科學館 301", Weekday: 1, StartPeriod: "1", EndPeriod: "2", StartTime: "08:10", EndTime: "10:00"},
+				{Course: "班會", CourseCode: "1132B0001", Teacher: "陳美玲", Weekday: 2, StartPeriod: "N", EndPeriod: "N", StartTime: "12:10", EndTime: "13:00"},
+				{Course: "英文（二）", CourseCode: "1132C0456", Teacher: "Smith", Room: "語言中心 201", Weekday: 4, StartPeriod: "3", EndPeriod: "4", StartTime: "10:10", EndTime: "12:00"},
+				{Course: "體育：羽球", CourseCode: "1132D0789", Teacher: "張志豪", Room: "體育館", Weekday: 5, StartPeriod: "8", EndPeriod: "8", StartTime: "16:10", EndTime: "17:00"},
+			},
+		},
+	}
+
+	periods, err := ParsePeriodTimes(DefaultPeriodTimes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := ParseTimetable(readFixture(t, tt.fixture), periods)
+			if err != nil {
+				t.Fatalf("ParseTimetable() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTimetable()\n got: %s\nwant: %s", dumpClasses(got), dumpClasses(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseTimetableNotLoggedIn(t *testing.T) {
+	if _, err := ParseTimetable(readFixture(t, "login.html"), nil); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("ParseTimetable() error = %v, want ErrNotLoggedIn", err)
+	}
+}
+
+func TestParsePeriodTimes(t *testing.T) {
+	periods, err := ParsePeriodTimes(" 1=8:10-9:00, n=12：10～13：00 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PeriodTimes{"1": {"08:10", "09:00"}, "N": {"12:10", "13:00"}}
+	if !reflect.DeepEqual(periods, want) {
+		t.Errorf("ParsePeriodTimes() = %v, want %v", periods, want)
+	}
+
+	for _, raw := range []string{"1", "1=25:00-26:00", "1=08:10"} {
+		if _, err := ParsePeriodTimes(raw); err == nil {
+			t.Errorf("ParsePeriodTimes(%q) 應回傳錯誤", raw)
+		}
+	}
+}
+
+func dumpClasses(classes []Class) string {
+	var s string
+	for _, c := range classes {
+		s += fmt.Sprintf("\n  星期%d %s-%s %s-%s %s %s 教師=%s 教室=%s",
+			c.Weekday, c.StartPeriod, c.EndPeriod, c.StartTime, c.EndTime, c.CourseCode, c.Course, c.Teacher, c.Room)
+	}
+	return s
+}
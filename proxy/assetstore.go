@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"better-myUT/assets"
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 檔案變動後等待多久才重新載入，避免編輯器連續寫入時重複載入
+const assetReloadDebounce = 200 * time.Millisecond
+
+// 注入用的 CSS / JS 與圖片來源
+//
+// 設定覆寫目錄後，目錄中與嵌入檔同名的檔案（例如 tables.css、injected.js、img/icon.png）
+// 會取代嵌入版本，且檔案變動時自動重新載入；檔案不存在或讀取失敗時退回嵌入版本。
+type assetStore struct {
+	dir string
+	css atomic.Value // string
+	js  atomic.Value // string
+}
+
+func newAssetStore(dir string) *assetStore {
+	s := &assetStore{dir: dir}
+	s.reload()
+	return s
+}
+
+// 目前生效的合併 CSS
+func (s *assetStore) CSS() string {
+	return s.css.Load().(string)
+}
+
+// 目前生效的注入腳本
+func (s *assetStore) JS() string {
+	return s.js.Load().(string)
+}
+
+// 讀取圖片，覆寫目錄中的 img/ 優先
+func (s *assetStore) Image(name string) ([]byte, error) {
+	if s.dir != "" && filepath.Base(name) == name {
+		if data, err := os.ReadFile(filepath.Join(s.dir, "img", name)); err == nil {
+			return data, nil
+		}
+	}
+	return assets.ImgFS.ReadFile("img/" + name)
+}
+
+// 讀取覆寫檔案，不存在時回傳 false
+func (s *assetStore) readOverride(name string) (string, bool) {
+	if s.dir == "" {
+		return "", false
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("⚠️  讀取覆寫資源 %s 失敗，改用嵌入版本: %v", name, err)
+		}
+		return "", false
+	}
+	log.Printf("🎨 使用覆寫資源: %s", name)
+	return string(data), true
+}
+
+// 重新組合 CSS 與 JS
+func (s *assetStore) reload() {
+	s.css.Store(assets.CombineCSS(s.readOverride))
+
+	js := assets.InjectedJS
+	if override, ok := s.readOverride(assets.InjectedJSName); ok {
+		js = override
+	}
+	s.js.Store(js)
+}
+
+// 監看覆寫目錄，檔案變動時重新載入，直到 ctx 結束
+func (s *assetStore) Watch(ctx context.Context) error {
+	if s.dir == "" {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(s.dir); err != nil {
+		watcher.Close()
+		return err
+	}
+	log.Printf("👀 監看資源覆寫目錄: %s", s.dir)
+
+	go func() {
+		defer watcher.Close()
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				log.Printf("資源檔案變動: %s (%s)", event.Name, event.Op)
+				debounce = time.After(assetReloadDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("⚠️  監看資源目錄發生錯誤: %v", err)
+			case <-debounce:
+				debounce = nil
+				s.reload()
+				log.Printf("✅ 已重新載入注入資源")
+			}
+		}
+	}()
+	return nil
+}
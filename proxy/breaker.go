@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 斷路器開啟時回傳的錯誤，代理會直接回傳錯誤頁而不連線上游
+var errCircuitOpen = errors.New("上游斷路器開啟中")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// 斷路器：上游失敗率過高時快速失敗，並透過半開探測自動恢復
+type circuitBreaker struct {
+	threshold    float64
+	minRequests  int
+	window       time.Duration
+	openDuration time.Duration
+	halfOpenMax  int
+
+	mu          sync.Mutex
+	state       breakerState
+	windowStart time.Time
+	total       int
+	failures    int
+	openedAt    time.Time
+	probes      int // 半開狀態下進行中的探測請求數
+}
+
+func newCircuitBreaker(cfg BreakerSettings) *circuitBreaker {
+	halfOpenMax := cfg.HalfOpenMax
+	if halfOpenMax < 1 {
+		halfOpenMax = 1
+	}
+	return &circuitBreaker{
+		threshold:    cfg.Threshold,
+		minRequests:  cfg.MinRequests,
+		window:       cfg.Window,
+		openDuration: cfg.OpenDuration,
+		halfOpenMax:  halfOpenMax,
+		windowStart:  time.Now(),
+	}
+}
+
+// 判斷是否允許發出請求；允許時必須以 Done 回報結果
+func (b *circuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < b.openDuration {
+			return errCircuitOpen
+		}
+		log.Printf("🟡 斷路器進入半開狀態，開始探測上游")
+		b.state = breakerHalfOpen
+		b.probes = 0
+		fallthrough
+	case breakerHalfOpen:
+		if b.probes >= b.halfOpenMax {
+			return errCircuitOpen
+		}
+		b.probes++
+		return nil
+	default:
+		if now.Sub(b.windowStart) > b.window {
+			b.windowStart = now
+			b.total = 0
+			b.failures = 0
+		}
+		return nil
+	}
+}
+
+// 回報請求結果
+func (b *circuitBreaker) Done(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerHalfOpen:
+		if b.probes > 0 {
+			b.probes--
+		}
+		if success {
+			log.Printf("🟢 上游探測成功，斷路器關閉")
+			b.reset(breakerClosed)
+		} else {
+			log.Printf("🔴 上游探測失敗，斷路器重新開啟")
+			b.trip()
+		}
+	case breakerClosed:
+		b.total++
+		if !success {
+			b.failures++
+		}
+		if b.total >= b.minRequests && float64(b.failures)/float64(b.total) >= b.threshold {
+			log.Printf("🔴 上游失敗率 %d/%d 超過門檻，斷路器開啟 %s", b.failures, b.total, b.openDuration)
+			b.trip()
+		}
+	}
+}
+
+// 放棄請求（例如使用者中斷連線），不計入成功或失敗
+func (b *circuitBreaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// 目前狀態，供狀態端點與日誌使用
+func (b *circuitBreaker) State() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) trip() {
+	b.reset(breakerOpen)
+	b.openedAt = time.Now()
+}
+
+func (b *circuitBreaker) reset(state breakerState) {
+	b.state = state
+	b.windowStart = time.Now()
+	b.total = 0
+	b.failures = 0
+	b.probes = 0
+}
+
+// 只有冪等方法才能安全重試，避免重複送出選課等 POST 表單
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// 可重試的上游狀態碼
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// 帶抖動的指數退避（full jitter）
+func retryBackoff(policy RetryPolicy, attempt int) time.Duration {
+	maxDelay := policy.MaxDelay
+	backoff := policy.BaseDelay << attempt
+	if backoff <= 0 || backoff > maxDelay {
+		backoff = maxDelay
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(backoff)) + 1)
+}
+
+// 經由斷路器執行上游請求，冪等請求在連線錯誤或 502/503/504 時有限次重試
+func (p *Server) doUpstream(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, int, error) {
+	maxAttempts := 1
+	if isIdempotentMethod(req.Method) {
+		maxAttempts += p.retry.Retries
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := p.breaker.Allow(); err != nil {
+			log.Printf("⛔ 斷路器開啟中，拒絕上游請求: %s", req.URL.String())
+			return nil, attempt, err
+		}
+
+		// 重試時需要重建請求 body
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				p.breaker.Cancel()
+				return nil, attempt, fmt.Errorf("重建請求 body 失敗: %w", err)
+			}
+			req.Body = body
+		}
+
+		resp, err := client.Do(req)
+
+		// 使用者中斷請求不算上游失敗，也不重試
+		if err != nil && ctx.Err() != nil {
+			p.breaker.Cancel()
+			return nil, attempt + 1, err
+		}
+
+		failed := err != nil || resp.StatusCode >= 500
+		p.breaker.Done(!failed)
+
+		retryable := err != nil || isRetryableStatus(resp.StatusCode)
+		if !retryable || attempt+1 >= maxAttempts {
+			return resp, attempt + 1, err
+		}
+
+		if err != nil {
+			log.Printf("🔁 上游請求失敗 (第%d次)，準備重試: %v", attempt+1, err)
+		} else {
+			log.Printf("🔁 上游回應 %d (第%d次)，準備重試", resp.StatusCode, attempt+1)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(retryBackoff(p.retry, attempt)):
+		case <-ctx.Done():
+			return nil, attempt + 1, ctx.Err()
+		}
+	}
+}
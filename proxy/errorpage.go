@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"better-myUT/assets"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// 超過最大重定向次數時回傳的錯誤
+var errTooManyRedirects = errors.New("超過最大重定向次數")
+
+// 代理錯誤分類，決定顯示哪一種錯誤頁
+type ErrorKind string
+
+const (
+	errorKindTimeout         ErrorKind = "upstream_timeout"
+	errorKindUnreachable     ErrorKind = "upstream_unreachable"
+	errorKindTooManyHops     ErrorKind = "too_many_redirects"
+	errorKindUpstream5xx     ErrorKind = "upstream_error"
+	errorKindMaintenance     ErrorKind = "maintenance"
+	errorKindCircuitOpen     ErrorKind = "circuit_open"
+	errorKindProxyInternal   ErrorKind = "proxy_error"
+	errorKindUnknownFunction ErrorKind = "unknown_function"
+)
+
+// 錯誤頁顯示內容
+type errorPage struct {
+	Status  int
+	Icon    string
+	Title   string
+	Message string
+	Retry   bool
+}
+
+var errorPages = map[ErrorKind]errorPage{
+	errorKindTimeout: {
+		Status:  http.StatusGatewayTimeout,
+		Icon:    "⏳",
+		Title:   "校務系統回應逾時",
+		Message: "學校的校務系統目前回應太慢，可能正值選課或查詢尖峰。請稍候片刻再重新整理。",
+		Retry:   true,
+	},
+	errorKindUnreachable: {
+		Status:  http.StatusBadGateway,
+		Icon:    "🔌",
+		Title:   "無法連線到校務系統",
+		Message: "代理伺服器暫時連不上學校的校務系統，可能是學校網路或伺服器異常。請稍後再試。",
+		Retry:   true,
+	},
+	errorKindTooManyHops: {
+		Status:  http.StatusBadGateway,
+		Icon:    "🔁",
+		Title:   "頁面重新導向次數過多",
+		Message: "校務系統不斷將頁面重新導向，通常是登入狀態失效所致。請回到首頁重新登入。",
+		Retry:   false,
+	},
+	errorKindUpstream5xx: {
+		Status:  http.StatusBadGateway,
+		Icon:    "🏫",
+		Title:   "校務系統發生錯誤",
+		Message: "學校的校務系統回傳了伺服器錯誤，這不是你的操作問題。請稍後再重新整理。",
+		Retry:   true,
+	},
+	errorKindMaintenance: {
+		Status:  http.StatusServiceUnavailable,
+		Icon:    "🛠️",
+		Title:   "系統維護中",
+		Message: "更好的校務系統正在進行維護，請稍後再回來。",
+		Retry:   true,
+	},
+	errorKindCircuitOpen: {
+		Status:  http.StatusServiceUnavailable,
+		Icon:    "🚧",
+		Title:   "校務系統暫時不穩定",
+		Message: "學校的校務系統最近頻繁出錯，為避免加重負擔，代理暫停轉送請求，稍後會自動恢復。請過一會兒再重新整理。",
+		Retry:   true,
+	},
+	errorKindUnknownFunction: {
+		Status:  http.StatusNotFound,
+		Icon:    "🔎",
+		Title:   "找不到這個功能",
+		Message: "連結中的功能代碼無法辨識，請確認連結是否完整，或回到首頁從選單開啟。",
+		Retry:   false,
+	},
+	errorKindProxyInternal: {
+		Status:  http.StatusBadGateway,
+		Icon:    "⚠️",
+		Title:   "代理請求失敗",
+		Message: "處理你的請求時發生未預期的錯誤，請稍後再試。",
+		Retry:   true,
+	},
+}
+
+var errorPageTemplate = template.Must(template.New("errorpage").Parse(assets.ErrorPageHTML))
+
+// 依錯誤型別判斷是哪一種代理失敗（即錯誤頁的 X-Proxy-Error 代碼）
+func ClassifyError(err error) ErrorKind {
+	if errors.Is(err, errTooManyRedirects) {
+		return errorKindTooManyHops
+	}
+
+	if errors.Is(err, errCircuitOpen) {
+		return errorKindCircuitOpen
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorKindTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errorKindTimeout
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return errorKindUnreachable
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return errorKindUnreachable
+	}
+
+	return errorKindProxyInternal
+}
+
+// 錯誤分類對應的 HTTP 狀態碼
+func (k ErrorKind) Status() int {
+	if page, ok := errorPages[k]; ok {
+		return page.Status
+	}
+	return errorPages[errorKindProxyInternal].Status
+}
+
+// 是否為瀏覽器的頁面瀏覽請求（而非 Ajax 或資源請求），只有這類請求才適合回傳 HTML 錯誤頁
+func wantsErrorPage(r *http.Request) bool {
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return false
+	}
+	accept := strings.ToLower(r.Header.Get("Accept"))
+	return accept == "" || strings.Contains(accept, "text/html") || strings.Contains(accept, "*/*")
+}
+
+// 輸出錯誤頁；Ajax 請求則回傳 JSON 以免前端腳本解析失敗
+func (p *Server) writeErrorPage(w http.ResponseWriter, r *http.Request, kind ErrorKind, message string) {
+	page, ok := errorPages[kind]
+	if !ok {
+		page = errorPages[errorKindProxyInternal]
+	}
+	if message != "" {
+		page.Message = message
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate, private, max-age=0")
+	w.Header().Set("X-Proxy-Error", string(kind))
+	switch kind {
+	case errorKindMaintenance:
+		w.Header().Set("Retry-After", "300")
+	case errorKindCircuitOpen:
+		w.Header().Set("Retry-After", "30")
+	}
+
+	if !wantsErrorPage(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(page.Status)
+		json.NewEncoder(w).Encode(map[string]string{"error": string(kind), "message": page.Message})
+		return
+	}
+
+	nonce := newNonce()
+	var buf bytes.Buffer
+	err := errorPageTemplate.Execute(&buf, struct {
+		errorPage
+		CSS   template.CSS
+		Code  string
+		Path  string
+		Nonce string
+	}{
+		errorPage: page,
+		CSS:       template.CSS(p.assets.CSS()),
+		Code:      string(kind),
+		Path:      r.URL.Path,
+		Nonce:     nonce,
+	})
+	if err != nil {
+		log.Printf("❌ 錯誤頁模板渲染失敗: %v", err)
+		http.Error(w, page.Title, page.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	p.security.apply(w.Header(), nonce)
+	w.WriteHeader(page.Status)
+	w.Write(buf.Bytes())
+}
+
+// 維護模式：由設定或旗標檔案控制，維運人員可在不重啟的情況下切換
+type maintenanceMode struct {
+	enabled  bool   // maintenance.enabled 為 true 時強制開啟
+	flagFile string // 檔案存在即開啟，檔案內容作為顯示訊息
+}
+
+func newMaintenanceMode(enabled bool, flagFile string) *maintenanceMode {
+	return &maintenanceMode{
+		enabled:  enabled,
+		flagFile: flagFile,
+	}
+}
+
+// 回傳是否處於維護模式，以及自訂的維護訊息
+func (m *maintenanceMode) Active() (bool, string) {
+	if m == nil {
+		return false, ""
+	}
+	if m.flagFile != "" {
+		if data, err := os.ReadFile(m.flagFile); err == nil {
+			return true, strings.TrimSpace(string(data))
+		}
+	}
+	return m.enabled, ""
+}
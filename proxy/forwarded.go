@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// 前端反向代理（Nginx、Traefik、負載平衡器）的信任設定
+type ForwardedPolicy struct {
+	TrustedProxies []netip.Prefix // 只採信來自這些位址的 Forwarded / X-Forwarded-* 標頭
+	Hosts          []string       // 除了代理網址的主機外，另外允許的對外主機名稱（可含 port）
+}
+
+// 解析以 IP 或 CIDR 表示的信任代理清單
+func ParseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, item := range list {
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, fmt.Errorf("無效的 CIDR %q: %w", item, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("無效的 IP %q: %w", item, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// 請求是否直接來自信任的代理
+func (p *Server) fromTrustedProxy(r *http.Request) bool {
+	if len(p.forwarded.TrustedProxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.forwarded.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// 訪客看到的代理根網址（scheme://host），用於產生可分享或訂閱的完整網址
+func (p *Server) PublicBase(r *http.Request) string {
+	return p.publicBase(r)
+}
+
+// 訪客實際使用的代理網址（scheme://host），用於改寫頁面網址、Referer/Origin 與 cookie 屬性。
+//
+// 來自信任代理的請求依 Forwarded（優先）或 X-Forwarded-Proto / X-Forwarded-Host 判斷；
+// 否則以連線是否為 TLS 與 Host 標頭判斷。主機不在允許清單中時一律使用代理網址，
+// 未能判斷 scheme 時沿用代理網址的 scheme。
+func (p *Server) publicBase(r *http.Request) string {
+	if r == nil {
+		return p.publicURL
+	}
+	public, err := url.Parse(p.publicURL)
+	if err != nil {
+		return p.publicURL
+	}
+
+	scheme, host := "", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p.fromTrustedProxy(r) {
+		proto, forwardedHost := forwardedValues(r.Header)
+		if proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+
+	if !p.allowedHost(host, public.Host) {
+		return public.Scheme + "://" + public.Host
+	}
+	if scheme == "" {
+		scheme = public.Scheme
+	}
+	return scheme + "://" + strings.ToLower(host)
+}
+
+// 主機是否為代理網址的主機或另外允許的對外主機
+func (p *Server) allowedHost(host, publicHost string) bool {
+	if host == "" {
+		return false
+	}
+	if strings.EqualFold(host, publicHost) {
+		return true
+	}
+	for _, allowed := range p.forwarded.Hosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// 取出最後一個（由直接連線的信任代理加上的）代理記錄的 proto 與 host
+//
+// 代理通常將自己的記錄附加在既有標頭之後，前面的記錄可能是訪客自行偽造的，因此只採用最後一筆。
+func forwardedValues(h http.Header) (proto, host string) {
+	if forwarded := lastElement(h.Values("Forwarded")); forwarded != "" {
+		for _, pair := range strings.Split(forwarded, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(key) {
+			case "proto":
+				proto = strings.ToLower(value)
+			case "host":
+				host = value
+			}
+		}
+		return proto, host
+	}
+
+	proto = lastElement(h.Values("X-Forwarded-Proto"))
+	host = lastElement(h.Values("X-Forwarded-Host"))
+	return strings.ToLower(proto), host
+}
+
+// 逗號分隔清單（可能分成多行標頭）的最後一個元素
+func lastElement(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	last := values[len(values)-1]
+	if i := strings.LastIndex(last, ","); i >= 0 {
+		last = last[i+1:]
+	}
+	return strings.TrimSpace(last)
+}
+
+// 將瀏覽器送來的代理網址（Referer、Origin）換回上游網址
+func (p *Server) toUpstream(r *http.Request, value string) string {
+	if base := p.publicBase(r); base != p.publicURL {
+		value = strings.ReplaceAll(value, base, p.targetURL)
+	}
+	return strings.ReplaceAll(value, p.publicURL, p.targetURL)
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestForwardedValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		proto  string
+		host   string
+	}{
+		{
+			name:   "單一 Forwarded 記錄",
+			header: http.Header{"Forwarded": {`proto=https;host="myut.example.com"`}},
+			proto:  "https",
+			host:   "myut.example.com",
+		},
+		{
+			name:   "訪客偽造的 Forwarded 記錄排在前面",
+			header: http.Header{"Forwarded": {"proto=http;host=evil.example, for=192.0.2.1;proto=HTTPS;host=myut.example.com"}},
+			proto:  "https",
+			host:   "myut.example.com",
+		},
+		{
+			name:   "Forwarded 分成多行標頭",
+			header: http.Header{"Forwarded": {"host=evil.example", "proto=https;host=myut.example.com"}},
+			proto:  "https",
+			host:   "myut.example.com",
+		},
+		{
+			name:   "Forwarded 優先於 X-Forwarded-*",
+			header: http.Header{"Forwarded": {"proto=https;host=myut.example.com"}, "X-Forwarded-Host": {"other.example"}},
+			proto:  "https",
+			host:   "myut.example.com",
+		},
+		{
+			name: "X-Forwarded-* 取最後一筆",
+			header: http.Header{
+				"X-Forwarded-Proto": {"http, https"},
+				"X-Forwarded-Host":  {"evil.example", "myut.utaipei.edu.tw"},
+			},
+			proto: "https",
+			host:  "myut.utaipei.edu.tw",
+		},
+		{
+			name:   "沒有轉送標頭",
+			header: http.Header{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proto, host := forwardedValues(tt.header)
+			if proto != tt.proto || host != tt.host {
+				t.Errorf("forwardedValues() = %q, %q, want %q, %q", proto, host, tt.proto, tt.host)
+			}
+		})
+	}
+}
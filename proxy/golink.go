@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"better-myUT/portal"
+	"better-myUT/session"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// 校務系統首頁（登入頁與 frameset 入口）
+	HomePath = "/utaipei/index_sky.html"
+
+	// 功能深層連結的路徑前綴：/go/<功能代碼>
+	GoPathPrefix = "/go/"
+
+	// 尚未登入時暫存要開啟的功能代碼，登入後由注入腳本在主框架開啟
+	pendingGoCookie = "myut_go"
+	pendingGoMaxAge = 600
+)
+
+// 解析功能代碼對應表：「代碼=路徑」以分號分隔，例如 AG008=/utaipei/ag_pro/ag008.jsp
+func ParseFunctionPaths(raw string) (map[string]string, error) {
+	paths := make(map[string]string)
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		code, path, ok := strings.Cut(entry, "=")
+		code, path = strings.ToUpper(strings.TrimSpace(code)), strings.TrimSpace(path)
+		if !ok || code == "" || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("功能對應 %q 格式錯誤，應為 代碼=/路徑", entry)
+		}
+		paths[code] = path
+	}
+	return paths, nil
+}
+
+// 依訪客 session 的選單找出功能頁；inMenu 為選單中有此功能，選單未寫出功能頁時 page 為空字串
+type FunctionResolver func(r *http.Request, code string) (page string, inMenu bool)
+
+// 功能代碼對應的頁面：依序查設定的對應表、訪客選單中的功能，最後依 /utaipei/<系統>_pro/<代碼>.jsp 命名慣例推得
+func (p *Server) FunctionPath(r *http.Request, code string) (string, bool) {
+	code = strings.ToUpper(code)
+	if path, ok := p.functionPaths[code]; ok {
+		return path, true
+	}
+
+	inMenu := false
+	if p.resolveFunction != nil {
+		var page string
+		if page, inMenu = p.resolveFunction(r, code); page != "" {
+			return page, true
+		}
+	}
+
+	path, ok := session.FunctionPath(code)
+	if !ok {
+		return "", false
+	}
+	if inMenu {
+		log.Printf("🔗 選單未寫出 %s 的功能頁，依命名慣例推得 %s", code, path)
+	} else {
+		log.Printf("🔗 選單中找不到 %s（尚未載入選單或無此權限），依命名慣例推得 %s", code, path)
+	}
+	return path, true
+}
+
+// GET /go/<功能代碼>：先以訪客的 session 造訪首頁，再直接開啟該功能；尚未登入時先導向首頁登入
+func (p *Server) GoHandler(w http.ResponseWriter, r *http.Request) {
+	code := strings.ToUpper(strings.Trim(strings.TrimPrefix(r.URL.Path, GoPathPrefix), "/"))
+	target, ok := p.FunctionPath(r, code)
+	if !ok {
+		log.Printf("🔗 無法辨識的功能代碼: %q", code)
+		p.writeErrorPage(w, r, errorKindUnknownFunction, "")
+		return
+	}
+
+	if active, message := p.maintenance.Active(); active {
+		p.writeErrorPage(w, r, errorKindMaintenance, message)
+		return
+	}
+
+	// 從首頁登入後回來（resume=1）時不再暫存，避免登入失敗時來回導向
+	resume := r.URL.Query().Get("resume") == "1"
+	if session.ID(r) == "" {
+		p.deferGo(w, r, code, target, resume)
+		return
+	}
+
+	// 校務系統要求先造訪首頁，否則功能頁會回應 please logon from homepage；
+	// 首頁發給的 cookie 在開啟功能頁時一併送出
+	r = withUpstreamCookies(r)
+	referer, err := p.visitHomepage(w, r)
+	if err != nil {
+		kind := ClassifyError(err)
+		log.Printf("🔗 深層連結造訪首頁失敗 (%s): %v", kind, err)
+		p.writeErrorPage(w, r, kind, "")
+		return
+	}
+
+	body, err := p.fetchAs(w, r, target, referer)
+	if err != nil {
+		kind := ClassifyError(err)
+		log.Printf("🔗 深層連結開啟功能頁失敗 (%s): %v", kind, err)
+		p.writeErrorPage(w, r, kind, "")
+		return
+	}
+	if portal.LoginRequired(string(body)) {
+		p.deferGo(w, r, code, target, resume)
+		return
+	}
+
+	log.Printf("🔗 深層連結 %s → %s", code, target)
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// 尚未登入：暫存功能代碼並導向首頁，登入後由注入腳本接續開啟
+func (p *Server) deferGo(w http.ResponseWriter, r *http.Request, code, target string, resume bool) {
+	w.Header().Set("Cache-Control", "no-store")
+	if resume {
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+	log.Printf("🔗 深層連結 %s 需要先登入，導向首頁", code)
+	http.SetCookie(w, &http.Cookie{
+		Name:     pendingGoCookie,
+		Value:    code,
+		Path:     "/",
+		MaxAge:   pendingGoMaxAge,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, HomePath, http.StatusFound)
+}
+
+// 以訪客的 session 向上游 GET 指定頁面，並把上游發給的 cookie 轉給瀏覽器；referer 為空時使用首頁
+func (p *Server) fetchAs(w http.ResponseWriter, r *http.Request, path, referer string) ([]byte, error) {
+	target, err := url.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("頁面路徑 %q 不合法: %w", path, err)
+	}
+
+	req := r.Clone(r.Context())
+	req.Method = http.MethodGet
+	req.URL = &url.URL{Path: target.Path, RawQuery: target.RawQuery}
+	req.Body = nil
+	req.ContentLength = 0
+	for _, key := range []string{"Origin", "Referer", "X-Requested-With", "Content-Type"} {
+		req.Header.Del(key)
+	}
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	req.Header.Set("Accept-Encoding", "identity")
+
+	resp, body, err := p.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	p.copySetCookies(w, r, resp)
+	return body, nil
+}
+
+// 將上游的 Set-Cookie 改寫為代理網域可用的版本後加到回應
+func (p *Server) copySetCookies(w http.ResponseWriter, r *http.Request, resp *http.Response) {
+	for _, value := range resp.Header.Values("Set-Cookie") {
+		// 依 cookie 規則改為代理網域，必要時另外複製一份給 *.utaipei.edu.tw
+		for _, rewritten := range p.cookies.Rewrite(value, p.publicBase(r)) {
+			w.Header().Add("Set-Cookie", rewritten)
+		}
+	}
+}
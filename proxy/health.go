@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 上游狀態快照
+type UpstreamStatus struct {
+	Target        string     `json:"target"`
+	Up            bool       `json:"up"`
+	StatusCode    int        `json:"statusCode,omitempty"`
+	LatencyMs     int64      `json:"latencyMs"`
+	CheckedAt     time.Time  `json:"checkedAt"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time `json:"lastErrorAt,omitempty"`
+	LastSuccessAt *time.Time `json:"lastSuccessAt,omitempty"`
+	Cached        bool       `json:"cached"`
+	Breaker       string     `json:"breaker"`
+}
+
+// 以輕量請求探測上游校務系統，並快取結果（避免探測端點被頻繁呼叫時打爆學校伺服器）
+type UpstreamProber struct {
+	client    *http.Client
+	targetURL string
+	ttl       time.Duration
+
+	mu     sync.Mutex
+	status UpstreamStatus
+}
+
+func NewUpstreamProber(targetURL string, ttl time.Duration) *UpstreamProber {
+	return &UpstreamProber{
+		// 不共用 cookie jar，避免探測請求影響使用者的上游登入狀態
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		targetURL: targetURL,
+		ttl:       ttl,
+	}
+}
+
+// 取得上游狀態，快取過期時才重新探測
+func (u *UpstreamProber) Status() UpstreamStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.status.CheckedAt.IsZero() && time.Since(u.status.CheckedAt) < u.ttl {
+		status := u.status
+		status.Cached = true
+		return status
+	}
+
+	u.probe()
+	return u.status
+}
+
+// 實際探測上游，呼叫前須持有鎖
+func (u *UpstreamProber) probe() {
+	start := time.Now()
+	u.status.Target = u.targetURL
+	u.status.CheckedAt = start
+	u.status.Cached = false
+
+	req, err := http.NewRequest(http.MethodHead, u.targetURL, nil)
+	if err == nil {
+		var resp *http.Response
+		resp, err = u.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			u.status.StatusCode = resp.StatusCode
+			if resp.StatusCode >= 500 {
+				err = fmt.Errorf("上游回應 %s", resp.Status)
+			}
+		} else {
+			u.status.StatusCode = 0
+		}
+	}
+	u.status.LatencyMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		now := time.Now()
+		u.status.Up = false
+		u.status.LastError = err.Error()
+		u.status.LastErrorAt = &now
+		log.Printf("❌ 上游探測失敗 (%dms): %v", u.status.LatencyMs, err)
+		return
+	}
+
+	now := time.Now()
+	u.status.Up = true
+	u.status.LastSuccessAt = &now
+	log.Printf("✅ 上游探測成功: 狀態碼=%d (%dms)", u.status.StatusCode, u.status.LatencyMs)
+}
+
+// 存活檢查：只要行程能回應即視為存活
+func (p *Server) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+}
+
+// 就緒檢查：確認設定已載入且 session store（常用功能紀錄）可用
+func (p *Server) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{}
+	ready := true
+
+	if p.draining.Load() {
+		checks["draining"] = "伺服器正在關閉"
+		ready = false
+	}
+
+	if err := p.checkConfig(); err != nil {
+		checks["config"] = err.Error()
+		ready = false
+	} else {
+		checks["config"] = "ok"
+	}
+
+	if err := p.checkSessionStore(); err != nil {
+		checks["sessionStore"] = err.Error()
+		ready = false
+	} else {
+		checks["sessionStore"] = "ok"
+	}
+
+	status := http.StatusOK
+	statusText := "ready"
+	if !ready {
+		status = http.StatusServiceUnavailable
+		statusText = "not ready"
+	}
+
+	writeJSON(w, status, map[string]any{"status": statusText, "checks": checks})
+}
+
+// 上游狀態：區分「代理壞了」與「學校系統掛了」
+func (p *Server) UpstreamStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status := p.upstream.Status()
+	status.Breaker = p.breaker.State().String()
+
+	code := http.StatusOK
+	if !status.Up {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+func (p *Server) checkConfig() error {
+	if err := ValidateBaseURL("targetURL", p.targetURL); err != nil {
+		return err
+	}
+	return ValidateBaseURL("proxyURL", p.publicURL)
+}
+
+func (p *Server) checkSessionStore() error {
+	if p.sessions != nil {
+		return p.sessions.Check()
+	}
+	return nil
+}
+
+// 檢查根網址：必須能解析、為 http/https、包含主機名稱，且不可以 / 結尾（代理會直接在後面接上路徑）
+func ValidateBaseURL(name, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%s 無法解析: %v", name, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s 必須以 http:// 或 https:// 開頭，目前為 %q", name, raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s 缺少主機名稱: %q", name, raw)
+	}
+	if strings.HasSuffix(raw, "/") {
+		return fmt.Errorf("%s 不可以 / 結尾，請改為 %q", name, strings.TrimRight(raw, "/"))
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%s 不可包含查詢字串或片段: %q", name, raw)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
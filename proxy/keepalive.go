@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"better-myUT/portal"
+	"better-myUT/session"
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 保持上游 session 不逾時的設定（預設停用）
+type KeepAlivePolicy struct {
+	Enabled        bool
+	Path           string        // 保持連線時向上游請求的輕量頁面
+	Interval       time.Duration // 同一 session 兩次向上游請求的最短間隔
+	MaxIdle        time.Duration // 最後一次實際操作後最多保持多久，超過即不再延長
+	RatePerMinute  int           // 全站每分鐘最多向上游發出的保持連線請求數
+	SessionTimeout time.Duration // 上游 session 閒置逾時時間，用於計算剩餘時間
+	WarnBefore     time.Duration // 剩餘時間少於此值時前端顯示警告
+}
+
+func DefaultKeepAlive() KeepAlivePolicy {
+	return KeepAlivePolicy{
+		Path:           HomePath,
+		Interval:       5 * time.Minute,
+		MaxIdle:        2 * time.Hour,
+		RatePerMinute:  120,
+		SessionTimeout: 20 * time.Minute,
+		WarnBefore:     3 * time.Minute,
+	}
+}
+
+// 記憶體中最多追蹤的 session 數
+const maxKeepAliveSessions = 10000
+
+// 保持連線的原因代碼
+const (
+	keepAliveOK          = "ok"           // 已向上游請求
+	keepAliveNotDue      = "not_due"      // 距上次向上游請求未達間隔，不需請求
+	keepAliveIdle        = "idle"         // 閒置超過上限，不再延長
+	keepAliveRateLimited = "rate_limited" // 全站請求數達上限
+	keepAliveExpired     = "expired"      // 上游 session 已過期
+	keepAliveNoSession   = "no_session"   // 沒有 session cookie
+	keepAliveFailed      = "upstream_error"
+)
+
+type keepAliveContextKey struct{}
+
+// 標記為保持連線的請求，不算作實際操作
+func withKeepAlive(ctx context.Context) context.Context {
+	return context.WithValue(ctx, keepAliveContextKey{}, true)
+}
+
+func isKeepAlive(ctx context.Context) bool {
+	v, _ := ctx.Value(keepAliveContextKey{}).(bool)
+	return v
+}
+
+type keepAliveSession struct {
+	lastActivity time.Time // 最後一次實際操作（非保持連線）的上游請求
+	lastUpstream time.Time // 最後一次向上游請求（含保持連線）
+}
+
+// 追蹤各 session 的上游請求時間，並限制全站保持連線請求的速率
+type keepAliveTracker struct {
+	mu          sync.Mutex
+	sessions    map[string]*keepAliveSession
+	windowStart time.Time
+	windowCount int
+}
+
+func newKeepAliveTracker() *keepAliveTracker {
+	return &keepAliveTracker{sessions: make(map[string]*keepAliveSession)}
+}
+
+// 記錄 session 向上游發出請求
+func (t *keepAliveTracker) touch(id string, keepAlive bool) {
+	if id == "" {
+		return
+	}
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.sessionLocked(id, now)
+	s.lastUpstream = now
+	if !keepAlive {
+		s.lastActivity = now
+	}
+}
+
+func (t *keepAliveTracker) sessionLocked(id string, now time.Time) *keepAliveSession {
+	s, ok := t.sessions[id]
+	if ok {
+		return s
+	}
+	if len(t.sessions) >= maxKeepAliveSessions {
+		// 移除最久未向上游請求的一半
+		cutoff := now
+		for _, s := range t.sessions {
+			if s.lastUpstream.Before(cutoff) {
+				cutoff = s.lastUpstream
+			}
+		}
+		cutoff = cutoff.Add(now.Sub(cutoff) / 2)
+		for key, s := range t.sessions {
+			if s.lastUpstream.Before(cutoff) {
+				delete(t.sessions, key)
+			}
+		}
+	}
+	s = &keepAliveSession{lastActivity: now, lastUpstream: now}
+	t.sessions[id] = s
+	return s
+}
+
+// 判斷是否該向上游請求，並在允許時預先計入速率
+func (t *keepAliveTracker) reserve(id string, policy KeepAlivePolicy, now time.Time) (string, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.sessions[id]
+	if !ok {
+		// 代理重啟後第一次收到，視為剛操作過
+		s = t.sessionLocked(id, now)
+		s.lastUpstream = time.Time{}
+	}
+
+	if now.Sub(s.lastActivity) > policy.MaxIdle {
+		return keepAliveIdle, s.lastUpstream
+	}
+	if now.Sub(s.lastUpstream) < policy.Interval {
+		return keepAliveNotDue, s.lastUpstream
+	}
+
+	if now.Sub(t.windowStart) >= time.Minute {
+		t.windowStart, t.windowCount = now, 0
+	}
+	if t.windowCount >= policy.RatePerMinute {
+		return keepAliveRateLimited, s.lastUpstream
+	}
+	t.windowCount++
+	return keepAliveOK, s.lastUpstream
+}
+
+func (t *keepAliveTracker) lastUpstream(id string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok := t.sessions[id]; ok {
+		return s.lastUpstream
+	}
+	return time.Time{}
+}
+
+// 保持連線 API 回應
+type keepAliveResponse struct {
+	Pinged    bool   `json:"pinged"`    // 這次是否向上游請求
+	Reason    string `json:"reason"`    // 原因代碼
+	ExpiresIn int64  `json:"expiresIn"` // 上游 session 預估剩餘秒數
+	Warn      bool   `json:"warn"`      // 剩餘時間不足，前端應顯示警告
+}
+
+// POST /api/v1/keepalive：前端在分頁可見時定期呼叫，代理依間隔與上限決定是否以訪客的 session 請求上游
+func (p *Server) KeepAliveHandler(w http.ResponseWriter, r *http.Request) {
+	policy := p.keepAlivePolicy
+	if !policy.Enabled {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "keepalive_disabled", "message": "未啟用保持連線"})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	id := session.ID(r)
+	if id == "" {
+		writeJSON(w, http.StatusOK, keepAliveResponse{Reason: keepAliveNoSession})
+		return
+	}
+
+	now := time.Now()
+	reason, last := p.keepAlive.reserve(id, policy, now)
+	resp := keepAliveResponse{Reason: reason}
+	if reason == keepAliveOK {
+		body, err := p.fetchAs(w, r.WithContext(withKeepAlive(r.Context())), policy.Path, "")
+		switch {
+		case err != nil:
+			log.Printf("⚠️  保持連線請求失敗 (%s): %v", ClassifyError(err), err)
+			resp.Reason = keepAliveFailed
+		case portal.LoginRequired(string(body)):
+			resp.Reason = keepAliveExpired
+		default:
+			resp.Pinged = true
+		}
+		last = p.keepAlive.lastUpstream(id)
+	}
+
+	if resp.Reason == keepAliveExpired {
+		resp.Warn = true
+	} else {
+		if last.IsZero() {
+			last = now
+		}
+		remaining := policy.SessionTimeout - now.Sub(last)
+		resp.ExpiresIn = int64(max(remaining, 0).Seconds())
+		resp.Warn = remaining <= policy.WarnBefore
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
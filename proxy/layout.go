@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 版面偏好 cookie：cards 強制卡片、table 強制表格，未設定時依裝置判斷
+const layoutCookie = "myut_layout"
+
+// 注入腳本寫入的視窗寬度 cookie（CSS 像素）
+const viewportCookie = "myut_vw"
+
+// 視窗寬度不超過此值時改用卡片顯示表格，與 tables.css 的斷點一致
+const cardsMaxViewportWidth = 768
+
+// 要求瀏覽器在後續請求附上的 client hints
+const acceptClientHints = "Sec-CH-UA-Mobile, Sec-CH-Viewport-Width"
+
+// 判斷用戶端是否為窄螢幕，應將清單表格轉為卡片
+func prefersCards(r *http.Request) bool {
+	if c, err := r.Cookie(layoutCookie); err == nil {
+		switch c.Value {
+		case "cards":
+			return true
+		case "table":
+			return false
+		}
+	}
+
+	if width, ok := viewportWidth(r); ok {
+		return width <= cardsMaxViewportWidth
+	}
+
+	return r.Header.Get("Sec-CH-UA-Mobile") == "?1"
+}
+
+// 視窗寬度：優先使用 client hint，其次是注入腳本寫入的 cookie
+func viewportWidth(r *http.Request) (int, bool) {
+	raw := r.Header.Get("Sec-CH-Viewport-Width")
+	if raw == "" {
+		if c, err := r.Cookie(viewportCookie); err == nil {
+			raw = c.Value
+		}
+	}
+	width, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || width <= 0 {
+		return 0, false
+	}
+	return width, true
+}
+
+// 在 HTML 回應要求 client hints，並標示回應內容依這些標頭而異
+func setLayoutHints(h http.Header) {
+	h.Set("Accept-CH", acceptClientHints)
+	h.Add("Vary", acceptClientHints+", Cookie")
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"better-myUT/portal"
+	"better-myUT/session"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// 上游 session 已過期時加在代理回應上的標頭（值為 expired），前端可據此提示重新登入
+const SessionStateHeader = "X-Upstream-Session"
+
+// 依上游回應判斷登入狀態
+type LoginDetector struct {
+	Markers         []string // 回應內容出現任一字串（不分大小寫）即視為未登入或 session 過期
+	RedirectTargets []string // 重定向到路徑包含任一字串（不分大小寫）的頁面即視為 session 過期
+}
+
+func DefaultLoginDetector() LoginDetector {
+	return LoginDetector{
+		Markers:         []string{"please logon from homepage", "請重新登入", "請先登入"},
+		RedirectTargets: []string{"index_sky.html", "login"},
+	}
+}
+
+// 判斷一次上游請求的登入狀態，redirects 為 Do 過程中經過的重定向路徑
+//
+// 開啟功能頁成功視為已登入；出現標記或被導向登入頁視為過期；其餘無法判斷。
+// 直接請求登入頁本身（路徑符合 RedirectTargets）時不以重定向判斷，以免登入流程被誤判。
+func (d LoginDetector) detect(r *http.Request, resp *http.Response, body []byte, redirects []string) session.State {
+	if !containsFold(r.URL.Path, d.RedirectTargets) {
+		for _, location := range redirects {
+			if containsFold(location, d.RedirectTargets) {
+				return session.StateExpired
+			}
+		}
+	}
+
+	if !strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "html") {
+		return session.StateUnknown
+	}
+	if containsFold(string(body), d.Markers) {
+		return session.StateExpired
+	}
+	if _, ok := session.FunctionCode(r.URL); ok && resp.StatusCode == http.StatusOK {
+		return session.StateLoggedIn
+	}
+	return session.StateUnknown
+}
+
+// 字串是否包含任一子字串（不分大小寫）
+func containsFold(s string, subs []string) bool {
+	lower := strings.ToLower(s)
+	for _, sub := range subs {
+		if sub != "" && strings.Contains(lower, strings.ToLower(sub)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 記錄上游回應反映的登入狀態，過期時在回應加上 SessionStateHeader；並從頁面補上學號與姓名
+func (p *Server) observeLoginState(r *http.Request, resp *http.Response, body []byte, redirects []string) {
+	// 不轉送上游自帶的同名標頭
+	resp.Header.Del(SessionStateHeader)
+
+	state := p.login.detect(r, resp, body, redirects)
+	if state == session.StateExpired {
+		log.Printf("🔒 上游 session 未登入或已過期: %s", r.URL.Path)
+		resp.Header.Set(SessionStateHeader, string(state))
+	}
+
+	if p.sessions == nil {
+		return
+	}
+	id := session.ID(r)
+	p.sessions.Observe(id, state)
+
+	if state != session.StateExpired {
+		p.identify(id, resp, string(body))
+	}
+}
+
+// 登入表單的學號待確認、或已知學號但不知道姓名時，從登入後的頁面（例如首頁 banner）解析
+func (p *Server) identify(id string, resp *http.Response, page string) {
+	if !strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "html") {
+		return
+	}
+	info, ok := p.sessions.Info(id)
+	if !ok || (info.Pending == "" && (info.Student == "" || info.Name != "")) {
+		return
+	}
+	if portal.LoginRequired(page) {
+		return
+	}
+	if student, name := portal.ParseIdentity(page); student != "" || name != "" {
+		if p.sessions.Identify(id, student, name) {
+			log.Printf("🔐 已確認登入 session 的學號")
+		}
+	}
+}
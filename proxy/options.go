@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"better-myUT/cookies"
+	"better-myUT/rewrite"
+	"better-myUT/session"
+	"time"
+)
+
+// 建立 Server 時的選項
+type Option func(*options)
+
+// 冪等請求失敗時的重試策略
+type RetryPolicy struct {
+	Retries   int           // 最大重試次數，0 表示不重試
+	BaseDelay time.Duration // 指數退避的基礎延遲
+	MaxDelay  time.Duration // 單次退避延遲上限
+}
+
+// 斷路器參數
+type BreakerSettings struct {
+	Threshold    float64       // 統計窗內失敗率達此比例即開啟 (0-1]
+	MinRequests  int           // 統計窗內至少需有的請求數
+	Window       time.Duration // 失敗率統計窗
+	OpenDuration time.Duration // 開啟後多久進入半開狀態
+	HalfOpenMax  int           // 半開狀態允許同時進行的探測請求數
+}
+
+type options struct {
+	publicURL       string
+	timeout         time.Duration
+	retry           RetryPolicy
+	breaker         BreakerSettings
+	statusTTL       time.Duration
+	maintenance     bool
+	maintenanceFile string
+	assetsDir       string
+	rewriteRules    []rewrite.Rule
+	cors            CORSPolicy
+	transformers    []rewrite.Transformer
+	enable          []string
+	disable         []string
+	sessions        *session.Store
+	loginPaths      []string
+	loginFields     []string
+	functionPaths   map[string]string
+	resolveFunction FunctionResolver
+	warmUp          WarmUpPolicy
+	login           LoginDetector
+	keepAlive       KeepAlivePolicy
+	cookiePolicies  []cookies.Policy
+	forwarded       ForwardedPolicy
+	security        SecurityHeaders
+}
+
+func defaultOptions() options {
+	return options{
+		publicURL: "http://127.0.0.1:8080",
+		timeout:   30 * time.Second,
+		retry: RetryPolicy{
+			Retries:   2,
+			BaseDelay: 200 * time.Millisecond,
+			MaxDelay:  2 * time.Second,
+		},
+		breaker: BreakerSettings{
+			Threshold:    0.5,
+			MinRequests:  20,
+			Window:       30 * time.Second,
+			OpenDuration: 30 * time.Second,
+			HalfOpenMax:  3,
+		},
+		statusTTL:    30 * time.Second,
+		rewriteRules: rewrite.DefaultRules(),
+		cors:         DefaultCORS(),
+		warmUp:       DefaultWarmUp(),
+		login:        DefaultLoginDetector(),
+		keepAlive:    DefaultKeepAlive(),
+		security:     DefaultSecurityHeaders(),
+	}
+}
+
+// 部署後對外的代理伺服器網址，用於改寫 HTML、Referer/Origin 與 Set-Cookie；
+// 無法由請求判斷（或主機不在允許清單中）時使用
+func WithPublicURL(publicURL string) Option {
+	return func(o *options) { o.publicURL = publicURL }
+}
+
+// 單次上游請求逾時
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.timeout = timeout }
+}
+
+// 冪等請求的重試策略
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *options) { o.retry = policy }
+}
+
+// 斷路器參數
+func WithBreaker(settings BreakerSettings) Option {
+	return func(o *options) { o.breaker = settings }
+}
+
+// 上游狀態探測結果的快取時間
+func WithStatusTTL(ttl time.Duration) Option {
+	return func(o *options) { o.statusTTL = ttl }
+}
+
+// 維護模式：enabled 為 true 時強制開啟，flagFile 存在時亦開啟
+func WithMaintenance(enabled bool, flagFile string) Option {
+	return func(o *options) {
+		o.maintenance = enabled
+		o.maintenanceFile = flagFile
+	}
+}
+
+// 注入資源覆寫目錄
+func WithAssetsDir(dir string) Option {
+	return func(o *options) { o.assetsDir = dir }
+}
+
+// 網址改寫規則
+func WithRewriteRules(rules []rewrite.Rule) Option {
+	return func(o *options) { o.rewriteRules = rules }
+}
+
+// CORS 回應標頭設定
+func WithCORS(policy CORSPolicy) Option {
+	return func(o *options) { o.cors = policy }
+}
+
+// 額外註冊的頁面轉換器，名稱與內建轉換器相同時取代內建版本
+func WithTransformers(transformers ...rewrite.Transformer) Option {
+	return func(o *options) { o.transformers = append(o.transformers, transformers...) }
+}
+
+// 額外啟用（預設停用者）與停用的頁面轉換器名稱
+func WithTransformerConfig(enable, disable []string) Option {
+	return func(o *options) {
+		o.enable = enable
+		o.disable = disable
+	}
+}
+
+// 代理端 session store：由送往 loginPaths 的登入表單的 loginFields 欄位取得學號，
+// 經登入後頁面的身分資訊確認後記下 session 的學生；並記錄各學生最近使用的功能、在功能頁注入快速存取列
+func WithSessionStore(store *session.Store, loginPaths, loginFields []string) Option {
+	return func(o *options) {
+		o.sessions = store
+		o.loginPaths = loginPaths
+		o.loginFields = loginFields
+	}
+}
+
+// 深層連結 /go/<功能代碼> 的對應表，未列出的代碼由訪客選單或命名慣例推得頁面
+func WithFunctionPaths(paths map[string]string) Option {
+	return func(o *options) { o.functionPaths = paths }
+}
+
+// 深層連結依訪客 session 的選單找出功能頁（例如 menu.Searcher.FunctionPage）
+func WithFunctionResolver(resolve FunctionResolver) Option {
+	return func(o *options) { o.resolveFunction = resolve }
+}
+
+// 上游要求從首頁進入時的自動暖身與重送設定
+func WithWarmUp(policy WarmUpPolicy) Option {
+	return func(o *options) { o.warmUp = policy }
+}
+
+// 判斷上游登入狀態的內容標記與重定向目標
+func WithLoginDetector(detector LoginDetector) Option {
+	return func(o *options) { o.login = detector }
+}
+
+// 保持上游 session 不逾時的設定；Enabled 為 false 時 /api/v1/keepalive 回傳 404
+func WithKeepAlive(policy KeepAlivePolicy) Option {
+	return func(o *options) { o.keepAlive = policy }
+}
+
+// 上游 Set-Cookie 的改寫規則，未指定時使用 cookies.DefaultPolicies
+func WithCookiePolicies(policies []cookies.Policy) Option {
+	return func(o *options) { o.cookiePolicies = policies }
+}
+
+// 信任的前端反向代理與額外的對外主機，供依請求判斷訪客使用的代理網址
+func WithForwarded(policy ForwardedPolicy) Option {
+	return func(o *options) { o.forwarded = policy }
+}
+
+// 代理產生的 HTML 頁面加上的 CSP 等安全性標頭
+func WithSecurityHeaders(headers SecurityHeaders) Option {
+	return func(o *options) { o.security = headers }
+}
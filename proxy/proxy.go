@@ -0,0 +1,700 @@
+// Package proxy 實作校務系統的反向代理：轉送請求並跟隨重定向、改寫 Cookie 與網址，
+// 並為 HTML 注入手機版樣式。Server 實作 http.Handler，可直接掛在 net/http 或任何路由框架上。
+package proxy
+
+import (
+	"better-myUT/cookies"
+	"better-myUT/rewrite"
+	"better-myUT/session"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("better-myUT/proxy")
+
+type Server struct {
+	client      *http.Client
+	targetURL   string // upstream 目標網站
+	publicURL   string // 部署後對外的代理伺服器網址
+	cookies     *cookies.Rewriter
+	upstream    *UpstreamProber
+	maintenance *maintenanceMode
+	retry       RetryPolicy
+	breaker     *circuitBreaker
+	draining    atomic.Bool // 呼叫 Drain 後設為 true，/readyz 隨即回報未就緒
+	reloadable  atomic.Pointer[reloadableSettings]
+	assets      *assetStore
+	pipeline    *rewrite.Registry
+	sessions    *session.Store // 未設定時不記錄學號與常用功能
+	loginPaths  []string       // 登入表單送出的路徑
+	loginFields []string       // 登入表單中代表學號的欄位
+
+	functionPaths   map[string]string // 深層連結的功能代碼對應表（優先於選單與命名慣例）
+	resolveFunction FunctionResolver  // 依訪客選單找出功能頁，未設定時只用對應表與命名慣例
+	warmUp          WarmUpPolicy
+	login           LoginDetector
+
+	keepAlivePolicy KeepAlivePolicy
+	keepAlive       *keepAliveTracker
+
+	forwarded ForwardedPolicy // 前端反向代理的信任設定與額外的對外主機
+	security  SecurityHeaders // 代理產生的 HTML 頁面加上的安全性標頭
+}
+
+// 建立代理伺服器，targetURL 為上游校務系統根網址
+func New(targetURL string, opts ...Option) (*Server, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	client := &http.Client{
+		Timeout: o.timeout,
+	}
+
+	log.Printf("代理伺服器設置 - 目標: %s, 公開: %s", targetURL, o.publicURL)
+
+	p := &Server{
+		client:      client,
+		targetURL:   targetURL,
+		publicURL:   o.publicURL,
+		cookies:     cookies.NewRewriter(o.cookiePolicies),
+		upstream:    NewUpstreamProber(targetURL, o.statusTTL),
+		maintenance: newMaintenanceMode(o.maintenance, o.maintenanceFile),
+		retry:       o.retry,
+		breaker:     newCircuitBreaker(o.breaker),
+		assets:      newAssetStore(o.assetsDir),
+		sessions:    o.sessions,
+		loginPaths:  o.loginPaths,
+		loginFields: o.loginFields,
+
+		functionPaths:   o.functionPaths,
+		resolveFunction: o.resolveFunction,
+		warmUp:          o.warmUp,
+		login:           o.login,
+
+		keepAlivePolicy: o.keepAlive,
+		keepAlive:       newKeepAliveTracker(),
+
+		forwarded: o.forwarded,
+		security:  o.security,
+	}
+	p.reloadable.Store(newReloadableSettings(o.rewriteRules, o.cors))
+
+	p.pipeline = rewrite.NewRegistry()
+	p.pipeline.Register(p.builtinTransformers()...)
+	p.pipeline.Register(o.transformers...)
+	if err := p.pipeline.Configure(o.enable, o.disable); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// 開始排空：之後 /readyz 回報未就緒，讓負載平衡器停止導入流量
+func (p *Server) Drain() {
+	p.draining.Store(true)
+}
+
+// 讀取圖片資源，覆寫目錄中的 img/ 優先
+func (p *Server) Image(name string) ([]byte, error) {
+	return p.assets.Image(name)
+}
+
+// 監看資源覆寫目錄，檔案變動時重新載入，直到 ctx 結束
+func (p *Server) WatchAssets(ctx context.Context) error {
+	return p.assets.Watch(ctx)
+}
+
+// 代理處理器（實作 http.Handler，不依賴 gin）
+func (p *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 若為根路徑則導向入口頁
+	if r.URL.Path == "/" {
+		http.Redirect(w, r, HomePath, http.StatusFound)
+		return
+	}
+
+	// 記錄請求
+	log.Printf("收到請求: %s %s", r.Method, r.URL.String())
+
+	// 維護模式下不碰上游，直接回傳維護頁
+	if active, message := p.maintenance.Active(); active {
+		log.Printf("🛠️ 維護模式中，略過上游請求")
+		p.writeErrorPage(w, r, errorKindMaintenance, message)
+		return
+	}
+
+	// 詳細記錄認證相關的headers（用於除錯）
+	if cookies := r.Header.Get("Cookie"); cookies != "" {
+		log.Printf("Cookie: %s", cookies)
+	}
+	if userAgent := r.Header.Get("User-Agent"); userAgent != "" {
+		log.Printf("User-Agent: %s", userAgent)
+	}
+	if xRequestedWith := r.Header.Get("X-Requested-With"); xRequestedWith != "" {
+		log.Printf("X-Requested-With: %s", xRequestedWith)
+	}
+	if referer := r.Header.Get("Referer"); referer != "" {
+		log.Printf("Referer: %s", referer)
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		log.Printf("Origin: %s", origin)
+	}
+
+	// 登入請求先取出學號，登入成功後記錄到 session store
+	student := p.loginStudent(r)
+
+	// 使用既有邏輯執行代理請求，包含自動重定向；上游要求從首頁進入時自動造訪首頁後重送
+	// （暖身與重送共用這位訪客的 cookie）
+	r = withUpstreamCookies(r)
+	resp, body, err := p.doWithWarmUp(w, r)
+	if err != nil {
+		kind := ClassifyError(err)
+		log.Printf("代理請求失敗 (%s): %v", kind, err)
+		p.writeErrorPage(w, r, kind, "")
+		return
+	}
+	defer resp.Body.Close()
+
+	// 上游 5xx 的 HTML 頁面以我們的錯誤頁取代，方便學生理解並重試
+	if resp.StatusCode >= 500 && wantsErrorPage(r) &&
+		strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "text/html") {
+		log.Printf("上游回應錯誤: %s", resp.Status)
+		p.writeErrorPage(w, r, errorKindUpstream5xx, "")
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+
+	// 記錄登入的學號與開啟的功能頁（供常用功能與最近使用）
+	p.bindLogin(r, resp, body, student)
+	p.recordVisit(r, resp, contentType, body)
+
+	// 檢查是否為二進制文件（字體、圖片等）
+	isBinaryFile := false
+	lowerContentType := strings.ToLower(contentType)
+	lowerPath := strings.ToLower(r.URL.Path)
+
+	// 檢查Content-Type與路徑是否匹配
+	if (strings.HasSuffix(lowerPath, ".ttf") ||
+		strings.HasSuffix(lowerPath, ".woff") ||
+		strings.HasSuffix(lowerPath, ".woff2") ||
+		strings.HasSuffix(lowerPath, ".otf") ||
+		strings.HasSuffix(lowerPath, ".eot")) &&
+		!strings.Contains(lowerContentType, "font") {
+		log.Printf("⚠️  字體文件Content-Type不匹配! 路徑: %s, Content-Type: %s", r.URL.Path, contentType)
+		log.Printf("回應前100字元: %s", string(body[:min(100, len(body))]))
+
+		// 檢查是否實際是字體文件內容
+		if len(body) > 4 {
+			// WOFF文件以"wOFF"開頭
+			if string(body[:4]) == "wOFF" {
+				log.Printf("檢測到WOFF字體文件，修正Content-Type")
+				isBinaryFile = true
+				if strings.HasSuffix(lowerPath, ".woff2") {
+					contentType = "font/woff2"
+				} else {
+					contentType = "font/woff"
+				}
+			}
+			// TTF文件通常以特定字節序列開頭
+			if len(body) > 8 && (body[0] == 0x00 && body[1] == 0x01 && body[2] == 0x00 && body[3] == 0x00) {
+				log.Printf("檢測到TTF字體文件，修正Content-Type")
+				isBinaryFile = true
+				contentType = "font/ttf"
+			}
+		}
+	}
+
+	if strings.Contains(lowerContentType, "font") ||
+		strings.Contains(lowerContentType, "image") ||
+		strings.Contains(lowerContentType, "video") ||
+		strings.Contains(lowerContentType, "audio") ||
+		strings.Contains(lowerContentType, "application/octet-stream") ||
+		strings.Contains(lowerContentType, "application/pdf") ||
+		strings.Contains(lowerContentType, "application/font") ||
+		strings.Contains(lowerContentType, "application/x-font") ||
+		strings.HasSuffix(lowerPath, ".ttf") ||
+		strings.HasSuffix(lowerPath, ".otf") ||
+		strings.HasSuffix(lowerPath, ".woff") ||
+		strings.HasSuffix(lowerPath, ".woff2") ||
+		strings.HasSuffix(lowerPath, ".eot") ||
+		strings.HasSuffix(lowerPath, ".svg") ||
+		strings.HasSuffix(lowerPath, ".png") ||
+		strings.HasSuffix(lowerPath, ".jpg") ||
+		strings.HasSuffix(lowerPath, ".jpeg") ||
+		strings.HasSuffix(lowerPath, ".gif") ||
+		strings.HasSuffix(lowerPath, ".ico") ||
+		strings.HasSuffix(lowerPath, ".webp") ||
+		strings.HasSuffix(lowerPath, ".css") ||
+		strings.HasSuffix(lowerPath, ".js") ||
+		strings.Contains(lowerPath, "/font") {
+		isBinaryFile = true
+		log.Printf("檢測到二進制/靜態文件: %s (Content-Type: %s)", r.URL.Path, contentType)
+	}
+
+	// 如果是 JavaScript 或 CSS，視為可文字處理文件
+	if strings.Contains(lowerContentType, "javascript") || strings.Contains(lowerContentType, "css") || strings.Contains(lowerContentType, "json") {
+		isBinaryFile = false
+	}
+
+	// 非二進制內容交給頁面轉換管線（網址改寫、注入樣式、登入除錯紀錄等）
+	// 每個回應使用不同的 CSP nonce，加在注入的 <style> / <script> 上
+	nonce := newNonce()
+	modified := false
+	if !isBinaryFile {
+		var applied []string
+		body, applied = p.Transform(r.WithContext(withNonce(r.Context(), nonce)), resp.StatusCode, contentType, body)
+		modified = len(applied) > 0
+		if modified {
+			log.Printf("已套用頁面轉換器: %s", strings.Join(applied, ", "))
+		}
+	} else {
+		log.Printf("跳過二進制文件的頁面轉換")
+	}
+
+	// 複製 headers，Set-Cookie 需要將domain修改為代理domain
+	p.copySetCookies(w, r, resp)
+	for key, values := range resp.Header {
+		// 若我們修改了內容，就不要複製 Content-Length
+		if modified && strings.ToLower(key) == "content-length" {
+			continue
+		}
+
+		// 處理Set-Cookie headers - 需要將domain修改為代理domain
+		if strings.ToLower(key) == "set-cookie" {
+			continue
+		}
+
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	// 修正字體文件的Content-Type
+	if isBinaryFile {
+		if strings.HasSuffix(lowerPath, ".ttf") {
+			w.Header().Set("Content-Type", "font/ttf")
+		} else if strings.HasSuffix(lowerPath, ".woff") {
+			w.Header().Set("Content-Type", "font/woff")
+		} else if strings.HasSuffix(lowerPath, ".woff2") {
+			w.Header().Set("Content-Type", "font/woff2")
+		} else if strings.HasSuffix(lowerPath, ".eot") {
+			w.Header().Set("Content-Type", "application/vnd.ms-fontobject")
+		} else if strings.HasSuffix(lowerPath, ".otf") {
+			w.Header().Set("Content-Type", "font/otf")
+		}
+
+		// 如果我們之前修正了contentType，使用修正後的值
+		if contentType != resp.Header.Get("Content-Type") {
+			w.Header().Set("Content-Type", contentType)
+		}
+
+		// 確保二進制文件不會被快取禁用影響
+		w.Header().Del("Cache-Control")
+		w.Header().Del("Pragma")
+		w.Header().Del("Expires")
+		w.Header().Set("Cache-Control", "public, max-age=31536000")
+	}
+
+	// 要求瀏覽器附上螢幕資訊，供表格卡片版面判斷；並加上 CSP 等安全性標頭
+	if HTMLPage(r.URL.Path, contentType) {
+		setLayoutHints(w.Header())
+		p.security.apply(w.Header(), nonce)
+	}
+
+	// 添加CORS headers以支援Ajax請求（設定可透過 SIGHUP 重新載入）
+	settings := p.settings()
+	origin := r.Header.Get("Origin")
+	if origin != "" && !isBinaryFile && settings.allowsOrigin(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Allow-Methods", settings.cors.AllowMethods)
+		w.Header().Set("Access-Control-Allow-Headers", settings.cors.AllowHeaders)
+		w.Header().Set("Access-Control-Expose-Headers", settings.cors.ExposeHeaders)
+		w.Header().Set("Access-Control-Max-Age", settings.corsMaxAgeSeconds())
+	}
+
+	// 處理OPTIONS預檢請求
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// 內容經過轉換時，添加我們自己的 Content-Length
+	if modified {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	}
+
+	// 決定最終的狀態碼
+	finalStatusCode := resp.StatusCode
+	if finalStatusCode >= 300 && finalStatusCode < 400 {
+		// 攔截重定向，強制改寫為 200 OK，避免瀏覽器端跳轉
+		log.Printf("⚠️  偵測到後端重定向 (狀態碼 %d)，強制改寫為 200 OK。", finalStatusCode)
+		finalStatusCode = http.StatusOK
+	}
+
+	if finalStatusCode == http.StatusOK {
+		// 若原回應帶有 Location，移除以避免瀏覽器再次跳轉
+		w.Header().Del("Location")
+	}
+
+	// 使用我們決定的狀態碼
+	w.WriteHeader(finalStatusCode)
+
+	// 回傳 body
+	w.Write(body)
+	log.Printf("完成代理請求")
+}
+
+// 執行代理請求並自動跟隨重定向，回傳最終回應與已讀取的 body
+func (p *Server) Do(r *http.Request) (*http.Response, []byte, error) {
+	maxRedirects := 100
+
+	// 使用完整路徑，不去掉前綴
+	path := r.URL.Path
+	currentURL := p.targetURL + path
+	if r.URL.RawQuery != "" {
+		currentURL += "?" + r.URL.RawQuery
+	}
+
+	log.Printf("URL路徑處理: %s -> %s", r.URL.Path, currentURL)
+
+	// 保存原始請求的 body（如果有的話）
+	var bodyBytes []byte
+	if r.Body != nil {
+		var err error
+		bodyBytes, err = io.ReadAll(r.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("讀取請求 body 失敗: %w", err)
+		}
+		r.Body.Close()
+	}
+
+	// 記錄 session 最後向上游請求的時間，供保持連線判斷
+	if p.keepAlivePolicy.Enabled {
+		p.keepAlive.touch(session.ID(r), isKeepAlive(r.Context()))
+	}
+
+	// 經過的重定向路徑，供判斷登入狀態
+	var redirects []string
+
+	// 只送出訪客自己的 cookie 與本次重定向鏈中上游設定的 cookie；
+	// 中途跳轉收到的 Set-Cookie 併入最終回應，讓瀏覽器也能保存
+	jar := upstreamCookiesFor(r)
+	var hopSetCookies []string
+
+	for i := 0; i < maxRedirects; i++ {
+		log.Printf("代理到 (第%d次): %s", i+1, currentURL)
+
+		resp, body, err := p.doProxyHop(r, i, currentURL, bodyBytes, jar.header())
+		if err != nil {
+			return nil, nil, err
+		}
+		jar.update(resp)
+
+		// 檢查是否是重定向
+		if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+			location := resp.Header.Get("Location")
+			if location == "" {
+				log.Printf("重定向回應缺少 Location header，直接返回該回應")
+				// 如果沒有 Location header，直接返回這個回應
+				mergeSetCookies(resp, hopSetCookies)
+				p.observeLoginState(r, resp, body, redirects)
+				return resp, body, nil
+			}
+
+			log.Printf("檢測到重定向: %d -> %s", resp.StatusCode, location)
+
+			// 使用 net/url 來更穩健地處理重定向 URL
+			base, err := url.Parse(currentURL)
+			if err != nil {
+				log.Printf("❌ 無法解析當前 URL: %v", err)
+				// 不要返回重定向回應，而是繼續嘗試或返回錯誤
+				resp.Body.Close()
+				continue
+			}
+
+			newURL, err := base.Parse(location)
+			if err != nil {
+				log.Printf("❌ 無法解析重定向位置: %v", err)
+				// 不要返回重定向回應，而是繼續嘗試或返回錯誤
+				resp.Body.Close()
+				continue
+			}
+
+			// 檢查並處理導向 localhost 的情況
+			if newURL.Hostname() == "localhost" {
+				// 將其重寫為指向目標主機
+				newURL.Host = base.Host
+				log.Printf("重寫 localhost 重定向 -> %s", newURL.String())
+			}
+
+			currentURL = newURL.String()
+			redirects = append(redirects, newURL.Path)
+			hopSetCookies = append(hopSetCookies, resp.Header.Values("Set-Cookie")...)
+			log.Printf("✅ 重定向到: %s", currentURL)
+
+			resp.Body.Close()
+
+			// 對於重定向，通常改為 GET 請求（除非是 307/308）
+			if resp.StatusCode != 307 && resp.StatusCode != 308 {
+				r.Method = "GET"
+				bodyBytes = nil // 清空 body
+				log.Printf("🔄 重定向後改為 GET 請求")
+			}
+
+			continue
+		}
+
+		// 不是重定向，返回結果
+		log.Printf("✅ 最終回應: 狀態碼=%d, Content-Length=%d", resp.StatusCode, len(body))
+		mergeSetCookies(resp, hopSetCookies)
+		p.observeLoginState(r, resp, body, redirects)
+		return resp, body, nil
+	}
+
+	log.Printf("❌ 超過最大重定向次數 (%d)", maxRedirects)
+	return nil, nil, fmt.Errorf("%w (%d)", errTooManyRedirects, maxRedirects)
+}
+
+// 將重定向途中收到的 Set-Cookie 依序放在最終回應的 Set-Cookie 之前
+func mergeSetCookies(resp *http.Response, earlier []string) {
+	if len(earlier) == 0 {
+		return
+	}
+	resp.Header["Set-Cookie"] = append(earlier, resp.Header.Values("Set-Cookie")...)
+}
+
+// 送往追蹤資料的網址去除查詢字串，校務系統的查詢參數可能帶有學號等學生資料
+func redactQuery(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "REDACTED"
+	}
+	u.User, u.Fragment = nil, ""
+	return u.String()
+}
+
+// 執行單一次上游請求（重定向鏈中的一跳），並以 span 記錄；cookieHeader 為送往上游的 Cookie 標頭
+func (p *Server) doProxyHop(r *http.Request, hop int, currentURL string, bodyBytes []byte, cookieHeader string) (*http.Response, []byte, error) {
+	ctx, span := tracer.Start(r.Context(), "proxy.hop",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.Int("proxy.hop", hop+1),
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.full", redactQuery(currentURL)),
+		),
+	)
+	defer span.End()
+
+	// 重建請求 body（bytes.Reader 讓重試時可透過 GetBody 重新讀取）
+	var requestBody io.Reader
+	if len(bodyBytes) > 0 {
+		requestBody = bytes.NewReader(bodyBytes)
+	}
+
+	// 創建代理請求
+	proxyReq, err := http.NewRequestWithContext(ctx, r.Method, currentURL, requestBody)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "創建代理請求失敗")
+		return nil, nil, fmt.Errorf("創建代理請求失敗: %w", err)
+	}
+
+	// 複製原始請求的 headers
+	for key, values := range r.Header {
+		// 跳過某些可能會造成問題的headers
+		lowerKey := strings.ToLower(key)
+		if lowerKey == "host" {
+			continue // Host header 已經在下面單獨設置
+		}
+
+		// Cookie 由呼叫者依訪客的 session 組好，於下方設置
+		if lowerKey == "cookie" {
+			continue
+		}
+
+		for _, value := range values {
+			proxyReq.Header.Add(key, value)
+		}
+	}
+
+	// 🔧 設置正確的 Host header - 確保看起來像從學校官方網站訪問
+	proxyReq.Host = proxyReq.URL.Host
+
+	// 只轉發這位訪客的 cookie
+	if cookieHeader != "" {
+		log.Printf("🍪 轉發Cookie: %s", cookieHeader)
+		proxyReq.Header.Set("Cookie", cookieHeader)
+
+		// 對於認證相關的JSP頁面，額外記錄 Cookie 供除錯
+		if lowerURL := strings.ToLower(currentURL); strings.Contains(lowerURL, ".jsp") &&
+			(strings.Contains(lowerURL, "uaa") || strings.Contains(lowerURL, "auth")) {
+			log.Printf("🔐 認證JSP頁面Cookie檢查: %s", cookieHeader[:min(100, len(cookieHeader))])
+		}
+	}
+
+	// 對於認證相關請求，記錄 Host 設置用於除錯
+	if strings.Contains(strings.ToLower(currentURL), "uaa") ||
+		strings.Contains(strings.ToLower(currentURL), "auth") ||
+		strings.Contains(strings.ToLower(currentURL), "login") {
+		log.Printf("🏫 認證頁面Host設置: %s", proxyReq.Host)
+	}
+
+	// 🔧 確保重要的認證相關headers正確設置 - 假裝從學校官方網站訪問
+	// 處理 Referer header
+	if r.Header.Get("Referer") != "" {
+		// 將Referer中的代理地址替換為目標地址
+		referer := r.Header.Get("Referer")
+		referer = p.toUpstream(r, referer)
+		proxyReq.Header.Set("Referer", referer)
+	} else {
+		// 如果沒有 Referer，設置正確的學校首頁 Referer
+		proxyReq.Header.Set("Referer", p.targetURL+HomePath)
+	}
+
+	// 🔐 對於認證頁面，強制設置正確的學校首頁作為 Referer
+	if strings.Contains(strings.ToLower(currentURL), "uaa") ||
+		strings.Contains(strings.ToLower(currentURL), "auth") ||
+		strings.Contains(strings.ToLower(currentURL), "login") {
+		proxyReq.Header.Set("Referer", p.targetURL+HomePath)
+		log.Printf("🏫 認證頁面設置學校首頁Referer: %s", p.targetURL+HomePath)
+	}
+
+	// 🔐 一律確保所有請求都有完整的認證和瀏覽器headers
+
+	// 確保User-Agent（如果沒有則設置預設值）
+	if proxyReq.Header.Get("User-Agent") == "" {
+		if r.Header.Get("User-Agent") != "" {
+			proxyReq.Header.Set("User-Agent", r.Header.Get("User-Agent"))
+		} else {
+			// 設置預設的瀏覽器User-Agent
+			proxyReq.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+		}
+	}
+
+	// 確保Accept header（根據請求類型設置）
+	if proxyReq.Header.Get("Accept") == "" {
+		if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+			// Ajax請求
+			proxyReq.Header.Set("Accept", "application/json, text/javascript, */*; q=0.01")
+		} else {
+			// 一般HTML請求
+			proxyReq.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
+		}
+	}
+
+	// 確保Accept-Language
+	if proxyReq.Header.Get("Accept-Language") == "" {
+		proxyReq.Header.Set("Accept-Language", "zh-TW,zh;q=0.9,en;q=0.8")
+	}
+
+	// 確保Accept-Encoding
+	if proxyReq.Header.Get("Accept-Encoding") == "" {
+		proxyReq.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+
+	// 一律設置防快取headers（確保認證狀態即時更新）
+	proxyReq.Header.Set("Cache-Control", "no-cache")
+	proxyReq.Header.Set("Pragma", "no-cache")
+
+	// 確保Connection header
+	if proxyReq.Header.Get("Connection") == "" {
+		proxyReq.Header.Set("Connection", "keep-alive")
+	}
+
+	// 確保Upgrade-Insecure-Requests
+	if proxyReq.Header.Get("Upgrade-Insecure-Requests") == "" && r.Method == "GET" {
+		proxyReq.Header.Set("Upgrade-Insecure-Requests", "1")
+	}
+
+	// 對於Ajax請求，確保X-Requested-With
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		proxyReq.Header.Set("X-Requested-With", "XMLHttpRequest")
+	}
+
+	// 記錄特殊認證檢查請求
+	if strings.Contains(strings.ToLower(currentURL), "perchk.jsp") ||
+		strings.Contains(strings.ToLower(currentURL), "check") ||
+		strings.Contains(strings.ToLower(currentURL), "auth") {
+		log.Printf("🔐 認證檢查請求: %s", currentURL)
+	}
+
+	// 🔧 設置Origin header（對於CORS很重要）- 確保來源看起來是學校官方網站
+	if origin := r.Header.Get("Origin"); origin != "" {
+		// 將Origin中的代理地址替換為目標地址
+		origin = p.toUpstream(r, origin)
+		proxyReq.Header.Set("Origin", origin)
+	} else {
+		// 總是設置學校官方網站作為 Origin
+		proxyReq.Header.Set("Origin", p.targetURL)
+	}
+
+	// 🔐 對於認證相關請求，強制設置學校官方網站作為 Origin
+	if strings.Contains(strings.ToLower(currentURL), "uaa") ||
+		strings.Contains(strings.ToLower(currentURL), "auth") ||
+		strings.Contains(strings.ToLower(currentURL), "login") {
+		proxyReq.Header.Set("Origin", p.targetURL)
+		log.Printf("🏫 認證頁面設置學校Origin: %s", p.targetURL)
+	}
+
+	// 創建不跟隨重定向的 client（不使用 cookie jar，cookie 只來自訪客本身）
+	tempClient := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: p.client.Timeout,
+	}
+
+	// 以 W3C traceparent 將追蹤資訊傳遞給上游
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(proxyReq.Header))
+
+	// 執行請求（經由斷路器，冪等請求失敗時有限次重試）
+	resp, attempts, err := p.doUpstream(ctx, tempClient, proxyReq)
+	span.SetAttributes(attribute.Int("proxy.attempts", attempts))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "執行代理請求失敗")
+		return nil, nil, fmt.Errorf("執行代理請求失敗: %w", err)
+	}
+
+	// 讀取回應內容
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "讀取回應失敗")
+		return nil, nil, fmt.Errorf("讀取回應失敗: %w", err)
+	}
+
+	log.Printf("🔄 收到回應: 狀態碼=%d, Content-Length=%d", resp.StatusCode, len(body))
+
+	span.SetAttributes(
+		attribute.Int("http.response.status_code", resp.StatusCode),
+		attribute.Int("http.response.body.size", len(body)),
+	)
+	if location := resp.Header.Get("Location"); location != "" {
+		span.SetAttributes(attribute.String("proxy.redirect.location", location))
+	}
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+
+	return resp, body, nil
+}
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"better-myUT/assets"
+	"better-myUT/portal"
+	"better-myUT/rewrite"
+	"better-myUT/session"
+	"bytes"
+	"context"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 登入表單最大讀取量，超過時不嘗試辨識學號
+const maxLoginFormSize = 64 << 10
+
+// 從登入請求的表單取出學號，並還原請求 body 供後續轉送
+//
+// 只處理送往登入路徑的 POST，其他帶有 uid 等欄位的表單（例如查詢他人資料）不視為登入。
+func (p *Server) loginStudent(r *http.Request) string {
+	if p.sessions == nil || r.Method != http.MethodPost || r.Body == nil || !p.loginPath(r.URL.Path) ||
+		!strings.HasPrefix(strings.ToLower(r.Header.Get("Content-Type")), "application/x-www-form-urlencoded") {
+		return ""
+	}
+
+	// 讀過的部分接回原本的 body，照常轉送
+	orig := r.Body
+	body, err := io.ReadAll(io.LimitReader(orig, maxLoginFormSize+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), orig), orig}
+	if err != nil || len(body) > maxLoginFormSize {
+		return ""
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	return session.StudentFromForm(form, p.loginFields)
+}
+
+// 是否為登入表單送出的路徑（不分大小寫）
+func (p *Server) loginPath(path string) bool {
+	for _, loginPath := range p.loginPaths {
+		if strings.EqualFold(path, loginPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// 登入表單送出後記下待確認的學號；上游重新發給 session cookie 時一併記錄
+//
+// 表單中的學號只是候選，須等登入後的頁面（回應本身或之後的首頁 banner）解析出相同學號才會對應到 session，
+// 以免登入失敗或冒用他人學號時誤綁。
+func (p *Server) bindLogin(r *http.Request, resp *http.Response, body []byte, student string) {
+	if student == "" || resp.StatusCode >= 400 {
+		return
+	}
+	page := string(body)
+	if portal.LoginRequired(page) || containsFold(page, p.login.Markers) {
+		log.Printf("🔐 登入未成功，不記錄學號")
+		return
+	}
+
+	ids := []string{session.ID(r)}
+	for _, cookie := range resp.Cookies() {
+		if strings.EqualFold(cookie.Name, session.CookieName) {
+			ids = append(ids, cookie.Value)
+		}
+	}
+	for _, id := range ids {
+		p.sessions.Expect(id, student)
+		p.identify(id, resp, page)
+	}
+	log.Printf("🔐 已送出登入表單，待頁面確認學號")
+}
+
+// 記錄學生開啟的功能頁
+func (p *Server) recordVisit(r *http.Request, resp *http.Response, contentType string, body []byte) {
+	if p.sessions == nil || r.Method != http.MethodGet || resp.StatusCode != http.StatusOK ||
+		!HTMLPage(r.URL.Path, contentType) {
+		return
+	}
+	student, ok := p.sessions.Student(session.ID(r))
+	if !ok {
+		return
+	}
+	page := string(body)
+	if portal.LoginRequired(page) {
+		return
+	}
+	if fn, ok := session.FunctionFromPage(r.URL, page); ok {
+		p.sessions.RecordVisit(student, fn)
+	}
+}
+
+// 功能頁（/utaipei/xx_pro/xxx.jsp）
+func functionPage(path, contentType string) bool {
+	_, ok := session.FunctionCode(&url.URL{Path: path})
+	return ok
+}
+
+// 在功能頁頂端注入常用功能與最近使用的快速存取列
+func (p *Server) injectQuickAccess(ctx context.Context, page *rewrite.Page) error {
+	if p.sessions == nil || page.Request == nil || page.Status != http.StatusOK ||
+		portal.LoginRequired(page.Body) {
+		return nil
+	}
+	student, ok := p.sessions.Student(session.ID(page.Request))
+	if !ok {
+		return nil
+	}
+	current, ok := session.FunctionFromPage(page.Request.URL, page.Body)
+	if !ok {
+		return nil
+	}
+
+	bar := renderQuickAccess(p.sessions.Profile(student), current, nonceAttr(ctx))
+	if loc := bodyStartRegex.FindStringIndex(page.Body); loc != nil {
+		page.Body = page.Body[:loc[1]] + bar + page.Body[loc[1]:]
+	} else {
+		page.Body = bar + page.Body
+	}
+	return nil
+}
+
+// 產生快速存取列：目前頁面的加入常用與分享連結按鈕、常用功能與最近使用（不含目前頁面）；
+// nonce 為 <script> 的 CSP nonce 屬性
+func renderQuickAccess(profile session.Profile, current session.Function, nonce string) string {
+	favorite := false
+	for _, fn := range profile.Favorites {
+		if strings.EqualFold(fn.Code, current.Code) {
+			favorite = true
+			break
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<nav class="myut-quick-access" data-code="` + html.EscapeString(current.Code) +
+		`" data-name="` + html.EscapeString(current.Name) +
+		`" data-path="` + html.EscapeString(current.Path) + `">`)
+	star, label := "☆", "加入常用"
+	if favorite {
+		star, label = "★", "移除常用"
+	}
+	b.WriteString(`<button type="button" class="myut-fav-toggle" aria-pressed="` + boolAttr(favorite) +
+		`" title="` + label + `">` + star + `</button>`)
+	b.WriteString(`<button type="button" class="myut-share-link" title="複製分享連結">🔗</button>`)
+	writeQuickLinks(&b, "常用", profile.Favorites, current.Code)
+	writeQuickLinks(&b, "最近", profile.Recent, current.Code)
+	b.WriteString(`</nav>`)
+	b.WriteString("\n<script" + nonce + ">\n" + assets.QuickAccessJS + "\n</script>\n")
+	return b.String()
+}
+
+func writeQuickLinks(b *strings.Builder, label string, list []session.Function, skip string) {
+	var links []string
+	for _, fn := range list {
+		if strings.EqualFold(fn.Code, skip) || !session.ValidFunction(fn) {
+			continue
+		}
+		links = append(links, `<a href="`+html.EscapeString(fn.Path)+`" title="`+html.EscapeString(fn.Code)+`">`+
+			html.EscapeString(fn.Name)+`</a>`)
+	}
+	if len(links) == 0 {
+		return
+	}
+	b.WriteString(`<span class="myut-quick-group"><span class="myut-quick-label">` + label + `</span>`)
+	b.WriteString(strings.Join(links, ""))
+	b.WriteString(`</span>`)
+}
+
+func boolAttr(v bool) string {
+	if v {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"better-myUT/rewrite"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CORS 回應標頭設定
+type CORSPolicy struct {
+	AllowedOrigins string // 逗號分隔，"*" 表示回應任何來源
+	AllowMethods   string
+	AllowHeaders   string
+	ExposeHeaders  string
+	MaxAge         time.Duration
+}
+
+// 預設 CORS 設定：回應任何來源，並允許校務系統 Ajax 會用到的方法與標頭
+func DefaultCORS() CORSPolicy {
+	return CORSPolicy{
+		AllowedOrigins: "*",
+		AllowMethods:   "GET, POST, PUT, DELETE, OPTIONS, PATCH",
+		AllowHeaders:   "Content-Type, Authorization, X-Requested-With, Accept, Origin, Cache-Control, Pragma, Cookie, Referer",
+		ExposeHeaders:  "Content-Length, Content-Type, Set-Cookie, Location, " + SessionStateHeader,
+		MaxAge:         24 * time.Hour,
+	}
+}
+
+// 執行期間可透過 UpdateSettings 替換的設定
+type reloadableSettings struct {
+	rewriteRules []rewrite.Rule
+	cors         CORSPolicy
+	corsOrigins  map[string]bool // nil 表示回應任何來源
+}
+
+func newReloadableSettings(rules []rewrite.Rule, cors CORSPolicy) *reloadableSettings {
+	s := &reloadableSettings{
+		rewriteRules: rules,
+		cors:         cors,
+	}
+
+	if origins := strings.TrimSpace(cors.AllowedOrigins); origins != "*" {
+		s.corsOrigins = map[string]bool{}
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				s.corsOrigins[strings.TrimRight(origin, "/")] = true
+			}
+		}
+	}
+	return s
+}
+
+// 檢查來源是否允許跨域存取
+func (s *reloadableSettings) allowsOrigin(origin string) bool {
+	return s.corsOrigins == nil || s.corsOrigins[origin]
+}
+
+// CORS 預檢快取秒數
+func (s *reloadableSettings) corsMaxAgeSeconds() string {
+	return fmt.Sprintf("%d", int64(s.cors.MaxAge/time.Second))
+}
+
+// 目前生效的可重載設定
+func (p *Server) settings() *reloadableSettings {
+	return p.reloadable.Load()
+}
+
+// 替換網址改寫規則與 CORS 設定，進行中的請求不受影響
+func (p *Server) UpdateSettings(rules []rewrite.Rule, cors CORSPolicy) {
+	p.reloadable.Store(newReloadableSettings(rules, cors))
+}
@@ -0,0 +1,232 @@
+package proxy
+
+import (
+	"better-myUT/rewrite"
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 內建頁面轉換器的執行順序，頁面專用的轉換器可插在這些數字之間
+const (
+	OrderRewriteURLs      = 100
+	OrderStripContextMenu = 200
+	OrderQuickAccess      = 250 // 在注入 CSS/JS 之前，以免注入的樣式影響登入頁判斷
+	OrderInjectAssets     = 300
+	OrderTableLabels      = 400
+	OrderTableCards       = 450
+	OrderDiagnostics      = 900
+)
+
+var (
+	headEndRegex   = regexp.MustCompile(`(?i)</head>`)
+	bodyStartRegex = regexp.MustCompile(`(?i)<body[^>]*>`)
+)
+
+var (
+	// 不注入 CSS/JS 的頁面：favorite.jsp 與 API 路徑
+	injectionExcluded = rewrite.AnyOf(
+		rewrite.PathSuffix("/favorite.jsp"),
+		rewrite.PathContains("_api.jsp", "/api/", "api.jsp"),
+	)
+
+	// 一般瀏覽的 HTML 頁面
+	HTMLPage = rewrite.All(rewrite.ContentType("text/html"), rewrite.Not(injectionExcluded))
+)
+
+// 內建的頁面轉換器
+func (p *Server) builtinTransformers() []rewrite.Transformer {
+	return []rewrite.Transformer{
+		rewrite.Stage{
+			ID:       "rewrite-urls",
+			Priority: OrderRewriteURLs,
+			Matcher:  rewrite.AnyOf(HTMLPage, rewrite.ContentType("javascript", "css", "json")),
+			Fn: func(ctx context.Context, page *rewrite.Page) error {
+				page.Body = rewrite.TargetURLs(page.Body, p.publicBase(page.Request), p.settings().rewriteRules)
+				return nil
+			},
+		},
+		rewrite.Stage{
+			ID:       "strip-contextmenu",
+			Priority: OrderStripContextMenu,
+			Matcher:  HTMLPage,
+			Fn: func(ctx context.Context, page *rewrite.Page) error {
+				page.Body = rewrite.StripContextMenu(page.Body)
+				return nil
+			},
+		},
+		rewrite.Stage{
+			ID:       "quick-access",
+			Priority: OrderQuickAccess,
+			Matcher:  rewrite.All(HTMLPage, functionPage),
+			Fn:       p.injectQuickAccess,
+		},
+		rewrite.Stage{
+			ID:       "inject-assets",
+			Priority: OrderInjectAssets,
+			Matcher:  HTMLPage,
+			Fn:       p.injectAssets,
+		},
+		rewrite.Stage{
+			ID:       "table-labels",
+			Priority: OrderTableLabels,
+			Matcher:  HTMLPage,
+			Fn: func(ctx context.Context, page *rewrite.Page) error {
+				page.Body = rewrite.AddTableDataLabels(ctx, page.Body)
+				return nil
+			},
+		},
+		rewrite.Stage{
+			ID:       "table-cards",
+			Priority: OrderTableCards,
+			Matcher:  HTMLPage,
+			Fn: func(ctx context.Context, page *rewrite.Page) error {
+				if page.Request != nil && prefersCards(page.Request) {
+					page.Body = rewrite.RenderTableCards(ctx, page.Body)
+				}
+				return nil
+			},
+		},
+		rewrite.Stage{
+			ID:       "auth-debug-log",
+			Priority: OrderDiagnostics,
+			Matcher:  rewrite.PathContains("favorite_api.jsp", "api", "perchk.jsp", "check"),
+			Fn:       logAuthResponse,
+		},
+		rewrite.Stage{
+			ID:       "uaa002-diagnostics",
+			Priority: OrderDiagnostics,
+			Matcher:  rewrite.PathContains("uaa002"),
+			Fn:       logUAA002Response,
+		},
+	}
+}
+
+// 頁面轉換器註冊表，可註冊頁面專用的轉換器（例如成績、課表、登入頁）
+func (p *Server) Transformers() *rewrite.Registry {
+	return p.pipeline
+}
+
+// 設定額外啟用與停用的轉換器，名稱不存在時回傳錯誤且保留原設定
+func (p *Server) ConfigureTransformers(enable, disable []string) error {
+	return p.pipeline.Configure(enable, disable)
+}
+
+// 以轉換管線處理上游回應，回傳處理後的內容與實際套用的轉換器
+func (p *Server) Transform(r *http.Request, status int, contentType string, body []byte) ([]byte, []string) {
+	ctx, span := tracer.Start(r.Context(), "transformPage", trace.WithAttributes(
+		attribute.String("url.path", r.URL.Path),
+		attribute.Int("html.input.size", len(body)),
+	))
+	defer span.End()
+
+	page := &rewrite.Page{
+		Request:     r,
+		Path:        r.URL.Path,
+		ContentType: contentType,
+		Status:      status,
+		Body:        string(body),
+	}
+	applied := p.pipeline.Apply(ctx, page)
+
+	span.SetAttributes(
+		attribute.StringSlice("transform.applied", applied),
+		attribute.Int("html.output.size", len(page.Body)),
+	)
+	if page.Body == string(body) {
+		return body, applied
+	}
+	return []byte(page.Body), applied
+}
+
+// 注入 viewport、快取禁用標籤、CSS，頂層 frameset 另注入 JavaScript 與圖標
+func (p *Server) injectAssets(ctx context.Context, page *rewrite.Page) error {
+	htmlStr := page.Body
+
+	// 讀取外部 injectedCSS 資料
+	responsiveCSS := "\n<style" + nonceAttr(ctx) + ">\n" + p.assets.CSS() + "\n</style>"
+
+	// 如為 frameset 頁（頂層），再注入 JavaScript
+	jsInjection := ""
+	iconInjection := ""
+	if strings.Contains(strings.ToLower(htmlStr), "<frameset") {
+		jsInjection = "\n<script" + nonceAttr(ctx) + ">\n" + p.assets.JS() + "\n</script>"
+
+		// 注入圖標
+		iconInjection = "<link rel='icon' href='/assets/img/icon.png' type='image/x-icon'>"
+	}
+
+	// 檢查並插入 viewport
+	viewportMeta := `<meta name="viewport" content="width=device-width,initial-scale=1">`
+
+	if !strings.Contains(strings.ToLower(htmlStr), "<meta name=\"viewport\"") {
+		htmlStr = strings.Replace(htmlStr, "<head>", "<head>"+viewportMeta, 1)
+	}
+
+	// 添加禁用快取的 meta 標籤
+	noCacheMetaTags := `
+<meta http-equiv="Cache-Control" content="no-cache, no-store, must-revalidate">
+<meta http-equiv="Pragma" content="no-cache">
+<meta http-equiv="Expires" content="0">
+<meta name="robots" content="noindex, nofollow, noarchive, nosnippet, noimageindex">
+`
+
+	// 在 </head> 之前插入 CSS 和 meta 標籤
+	if headEndRegex.MatchString(htmlStr) {
+		htmlStr = headEndRegex.ReplaceAllString(htmlStr, noCacheMetaTags+iconInjection+responsiveCSS+jsInjection+"</head>")
+	} else {
+		// 如果沒有 head 標籤，在 body 開始後插入
+		if bodyStartRegex.MatchString(htmlStr) {
+			htmlStr = bodyStartRegex.ReplaceAllStringFunc(htmlStr, func(match string) string {
+				return match + noCacheMetaTags + responsiveCSS + jsInjection
+			})
+		} else {
+			// 如果既沒有 <head> 也沒有 <body>，最後採用最保險方案：直接把 CSS 及 meta 標籤放到最前面
+			htmlStr = noCacheMetaTags + viewportMeta + responsiveCSS + jsInjection + htmlStr
+		}
+	}
+
+	page.Body = htmlStr
+	return nil
+}
+
+// 特別記錄API和權限檢查回應內容（用於除錯登入狀態）
+func logAuthResponse(ctx context.Context, page *rewrite.Page) error {
+	log.Printf("🔐 認證相關回應 (%s): 狀態=%d, 內容=%s",
+		page.Path, page.Status, page.Body[:min(500, len(page.Body))])
+	return nil
+}
+
+// 🔧 專門記錄 uaa002 頁面的認證檢查（用於除錯登入狀態問題）
+func logUAA002Response(ctx context.Context, page *rewrite.Page) error {
+	log.Printf("🚨 UAA002 認證檢查 (%s): 狀態=%d", page.Path, page.Status)
+
+	// 檢查回應內容是否包含登入相關的錯誤或重定向
+	bodyStr := page.Body
+	lowerBody := strings.ToLower(bodyStr)
+	if strings.Contains(lowerBody, "login") ||
+		strings.Contains(lowerBody, "登入") ||
+		strings.Contains(lowerBody, "unauthorized") ||
+		strings.Contains(lowerBody, "權限不足") ||
+		strings.Contains(lowerBody, "please logon from homepage") {
+		log.Printf("⚠️  UAA002 頁面包含登入相關內容: %s", bodyStr[:min(200, len(bodyStr))])
+
+		// 🔧 特別處理 "please logon from homepage" 錯誤
+		if strings.Contains(lowerBody, "please logon from homepage") {
+			log.Printf("🚨 檢測到 'please logon from homepage' 錯誤 - 系統要求從首頁登入")
+			log.Printf("💡 代理已自動造訪首頁後重送（見 warmUp 設定），仍出現時多半是尚未登入或 session 已過期")
+		}
+	}
+
+	// 檢查是否有 JavaScript 重定向
+	if strings.Contains(lowerBody, "location.href") ||
+		strings.Contains(lowerBody, "window.location") {
+		log.Printf("⚠️  UAA002 頁面包含重定向: %s", bodyStr[:min(300, len(bodyStr))])
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 一次訪客請求期間送往上游的 cookie：訪客自己送來的 Cookie，加上這段期間上游新設定的 cookie
+//
+// 代理不使用共用的 cookie jar，否則不同訪客的 JSESSIONID 會互相混用；
+// 同一次請求中的重定向、首頁暖身與重送透過 context 共用同一份。
+type upstreamCookies struct {
+	mu      sync.Mutex
+	raw     string         // 訪客送來的原始 Cookie 標頭
+	cookies []*http.Cookie // 依序保存的 cookie，上游設定後才會用到
+	changed bool           // 上游設定過 cookie 後改用 cookies 組出標頭
+}
+
+type upstreamCookiesKey struct{}
+
+// 讓之後以此 context 發出的上游請求共用同一份 cookie（例如暖身後重送原請求）
+func withUpstreamCookies(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(upstreamCookiesKey{}).(*upstreamCookies); ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), upstreamCookiesKey{}, newUpstreamCookies(r)))
+}
+
+// 取得請求共用的 cookie；沒有時只用這個請求自己的 Cookie 標頭
+func upstreamCookiesFor(r *http.Request) *upstreamCookies {
+	if c, ok := r.Context().Value(upstreamCookiesKey{}).(*upstreamCookies); ok {
+		return c
+	}
+	return newUpstreamCookies(r)
+}
+
+func newUpstreamCookies(r *http.Request) *upstreamCookies {
+	var values []string
+	for _, value := range r.Header.Values("Cookie") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return &upstreamCookies{raw: strings.Join(values, "; "), cookies: r.Cookies()}
+}
+
+// 送往上游的 Cookie 標頭
+func (c *upstreamCookies) header() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.changed {
+		return c.raw
+	}
+
+	pairs := make([]string, 0, len(c.cookies))
+	for _, cookie := range c.cookies {
+		pairs = append(pairs, (&http.Cookie{Name: cookie.Name, Value: cookie.Value}).String())
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// 套用上游回應的 Set-Cookie：同名者取代、過期者移除
+func (c *upstreamCookies) update(resp *http.Response) {
+	set := resp.Cookies()
+	if len(set) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, cookie := range set {
+		kept := c.cookies[:0]
+		for _, existing := range c.cookies {
+			if existing.Name != cookie.Name {
+				kept = append(kept, existing)
+			}
+		}
+		c.cookies = kept
+
+		expired := cookie.MaxAge < 0 || (!cookie.Expires.IsZero() && cookie.Expires.Before(now))
+		if !expired {
+			c.cookies = append(c.cookies, cookie)
+		}
+	}
+	c.changed = true
+}
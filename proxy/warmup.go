@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// 偵測到校務系統要求從首頁進入時的自動處理
+type WarmUpPolicy struct {
+	Markers   []string // 回應內容出現任一字串（不分大小寫）即視為需要先造訪首頁；為空時停用
+	Bootstrap []string // 依序造訪的首頁與 frameset 頁面，每一頁以前一頁作為 Referer
+}
+
+func DefaultWarmUp() WarmUpPolicy {
+	return WarmUpPolicy{
+		Markers:   []string{"please logon from homepage"},
+		Bootstrap: []string{HomePath},
+	}
+}
+
+// 回應是否為「請從首頁登入」
+func (p WarmUpPolicy) matches(body []byte) bool {
+	lower := bytes.ToLower(body)
+	for _, marker := range p.Markers {
+		if marker != "" && bytes.Contains(lower, []byte(strings.ToLower(marker))) {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否為暖身流程中的頁面，這些頁面本身不再觸發暖身以免循環
+func (p WarmUpPolicy) isBootstrap(path string) bool {
+	for _, b := range p.Bootstrap {
+		if strings.SplitN(b, "?", 2)[0] == path {
+			return true
+		}
+	}
+	return false
+}
+
+// 執行代理請求；若上游要求先從首頁進入，以訪客的 session 走一次首頁流程後重送原請求一次
+func (p *Server) doWithWarmUp(w http.ResponseWriter, r *http.Request) (*http.Response, []byte, error) {
+	if len(p.warmUp.Markers) == 0 || p.warmUp.isBootstrap(r.URL.Path) {
+		return p.Do(r)
+	}
+
+	// 保留原始請求以便重送：Do 遇到 301/302/303 重定向時會把 r.Method 改為 GET，
+	// 因此在第一次送出前先記下方法、網址、標頭與 body
+	method, target, header := r.Method, *r.URL, r.Header.Clone()
+	var reqBody []byte
+	if r.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("讀取請求 body 失敗: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, body, err := p.Do(r)
+	if err != nil || !p.warmUp.matches(body) {
+		return resp, body, err
+	}
+
+	log.Printf("🏠 %s 要求從首頁進入，自動造訪首頁後重送一次", target.Path)
+	referer, err := p.visitHomepage(w, r)
+	if err != nil {
+		log.Printf("⚠️  自動造訪首頁失敗，回傳原始回應: %v", err)
+		return resp, body, nil
+	}
+
+	replay := r.Clone(r.Context())
+	replay.Method = method
+	replay.URL = &target
+	replay.Header = header
+	replay.Header.Set("Referer", referer)
+	replay.Body, replay.ContentLength = nil, 0
+	if reqBody != nil {
+		replay.Body = io.NopCloser(bytes.NewReader(reqBody))
+		replay.ContentLength = int64(len(reqBody))
+	}
+	replayResp, replayBody, err := p.Do(replay)
+	if err != nil {
+		log.Printf("⚠️  重送請求失敗，回傳原始回應: %v", err)
+		return resp, body, nil
+	}
+	resp.Body.Close()
+
+	if p.warmUp.matches(replayBody) {
+		log.Printf("⚠️  造訪首頁後 %s 仍要求從首頁登入，可能尚未登入", target.Path)
+	} else {
+		log.Printf("✅ 造訪首頁後重送成功: %s", target.Path)
+	}
+	return replayResp, replayBody, nil
+}
+
+// 以訪客的 session 依序造訪首頁流程，每一頁以前一頁作為 Referer，回傳最後一頁的代理網址供下一個請求作為 Referer
+func (p *Server) visitHomepage(w http.ResponseWriter, r *http.Request) (string, error) {
+	referer, base := "", p.publicBase(r)
+	for _, path := range p.warmUp.Bootstrap {
+		if _, err := p.fetchAs(w, r, path, referer); err != nil {
+			return "", fmt.Errorf("造訪 %s 失敗: %w", path, err)
+		}
+		referer = base + path
+	}
+	return referer, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"better-myUT/proxy"
+	"better-myUT/rewrite"
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+)
+
+// 套用新設定中可熱重載的部分，並提示需要重啟才會生效的變更
+func applyConfig(myUTProxy *proxy.Server, old, cfg Config) {
+	myUTProxy.UpdateSettings(cfg.Rewrite.Rules, cfg.CORS.policy())
+	log.Printf("✅ 已重新載入網址改寫規則 (%d 條) 與 CORS 設定", len(cfg.Rewrite.Rules))
+
+	if err := myUTProxy.ConfigureTransformers(rewrite.SplitList(cfg.Transformers.Enable), rewrite.SplitList(cfg.Transformers.Disable)); err != nil {
+		log.Printf("❌ 重新載入頁面轉換器設定失敗，沿用原設定: %v", err)
+	} else {
+		log.Printf("✅ 已重新載入頁面轉換器設定")
+	}
+
+	// 其餘設定只在啟動時讀取
+	old.Rewrite, cfg.Rewrite = RewriteConfig{}, RewriteConfig{}
+	old.CORS, cfg.CORS = CORSConfig{}, CORSConfig{}
+	old.Transformers, cfg.Transformers = TransformersConfig{}, TransformersConfig{}
+	if !reflect.DeepEqual(old, cfg) {
+		log.Printf("⚠️  設定中有其他變更，需重新啟動才會生效")
+	}
+}
+
+// 收到 SIGHUP 時重新讀取設定檔（沿用啟動時的命令列參數），驗證失敗則保留原設定
+func watchReloadSignal(ctx context.Context, name string, args []string, startup Config, myUTProxy *proxy.Server) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				log.Printf("🔄 收到 SIGHUP，重新載入設定")
+				cfg, _, err := loadConfig(name, args, io.Discard)
+				if err != nil {
+					log.Printf("❌ 重新載入設定失敗，繼續使用原設定: %v", err)
+					continue
+				}
+				applyConfig(myUTProxy, startup, cfg)
+			}
+		}
+	}()
+}
@@ -0,0 +1,284 @@
+package rewrite
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 卡片最少需有幾列資料、幾個欄位才值得轉換（少於此數的多半是版面用表格）
+const (
+	minCardRows    = 1
+	minCardColumns = 3
+)
+
+// 常見的名稱欄位標題，作為卡片標題
+var cardTitleKeywords = []string{"科目名稱", "課程名稱", "課名", "科目", "名稱", "項目", "標題", "主旨"}
+
+// 將已加上 data-label 的清單表格轉為卡片清單，原始表格收進可展開的區塊
+//
+// 只處理 .stable 或具有表頭的清單表格，且表格中不可有會送出表單的欄位
+// （複製輸入欄位會讓表單重複送出）。連結與一般按鈕會複製到卡片的動作列。
+// 須在 AddTableDataLabels 之後執行；沒有可轉換的表格時回傳原始內容。
+func RenderTableCards(ctx context.Context, page string) string {
+	_, span := tracer.Start(ctx, "renderTableCards")
+	defer span.End()
+
+	if !strings.Contains(page, "data-label") {
+		return page
+	}
+
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		span.RecordError(err)
+		return page
+	}
+
+	var tables []*html.Node
+	forEachElement(doc, atom.Table, func(table *html.Node) {
+		if isCardCandidate(table) {
+			tables = append(tables, table)
+		}
+	})
+
+	converted := 0
+	for _, table := range tables {
+		if renderCards(table) {
+			converted++
+		}
+	}
+	span.SetAttributes(attribute.Int("table.cards.converted", converted))
+
+	if converted == 0 {
+		return page
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		span.RecordError(err)
+		return page
+	}
+	return buf.String()
+}
+
+// 是否為可轉換的清單表格
+func isCardCandidate(table *html.Node) bool {
+	if table.Parent == nil || insideElement(table, atom.Table) {
+		// 巢狀表格隨外層卡片一起複製，不另外轉換
+		return false
+	}
+	if containsFormField(table) {
+		return false
+	}
+
+	rows := tableRows(table)
+	labelledRows, maxColumns := 0, 0
+	for _, row := range rows {
+		columns := 0
+		for c := row.node.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.DataAtom == atom.Td && hasAttr(c, "data-label") {
+				columns++
+			}
+		}
+		if columns > 0 {
+			labelledRows++
+			maxColumns = max(maxColumns, columns)
+		}
+	}
+	if labelledRows < minCardRows {
+		return false
+	}
+	return hasClass(table, "stable") || maxColumns >= minCardColumns
+}
+
+// 產生卡片清單並插在表格前，原始表格移入 <details>
+func renderCards(table *html.Node) bool {
+	list := element(atom.Div, "class", "myut-cards")
+
+	for _, row := range tableRows(table) {
+		var cells []*html.Node
+		for c := row.node.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.DataAtom == atom.Td && hasAttr(c, "data-label") {
+				cells = append(cells, c)
+			}
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		if card := renderCard(cells); card != nil {
+			list.AppendChild(card)
+		}
+	}
+	if list.FirstChild == nil {
+		return false
+	}
+
+	parent := table.Parent
+	parent.InsertBefore(list, table)
+
+	details := element(atom.Details, "class", "myut-original-table")
+	summary := element(atom.Summary)
+	summary.AppendChild(&html.Node{Type: html.TextNode, Data: "顯示原始表格"})
+	details.AppendChild(summary)
+	parent.InsertBefore(details, table)
+	parent.RemoveChild(table)
+	details.AppendChild(table)
+	return true
+}
+
+// 單列資料轉為卡片：標題、欄位清單與動作列
+func renderCard(cells []*html.Node) *html.Node {
+	titleIndex := cardTitleIndex(cells)
+
+	card := element(atom.Div, "class", "myut-card")
+	fields := element(atom.Dl, "class", "myut-card-fields")
+	actions := element(atom.Div, "class", "myut-card-actions")
+
+	for i, cell := range cells {
+		label := attr(cell, "data-label")
+		text := cellText(cell)
+
+		if i == titleIndex {
+			title := element(atom.Div, "class", "myut-card-title")
+			appendClonedChildren(title, cell)
+			card.AppendChild(title)
+			continue
+		}
+
+		// 只有連結或按鈕的儲存格放到動作列
+		if text == "" || isActionCell(cell) {
+			if containsElement(cell, atom.A, atom.Button, atom.Input) {
+				appendClonedChildren(actions, cell)
+			}
+			continue
+		}
+
+		dt := element(atom.Dt)
+		dt.AppendChild(&html.Node{Type: html.TextNode, Data: label})
+		dd := element(atom.Dd)
+		appendClonedChildren(dd, cell)
+		fields.AppendChild(dt)
+		fields.AppendChild(dd)
+	}
+
+	if titleIndex < 0 && fields.FirstChild == nil && actions.FirstChild == nil {
+		return nil
+	}
+	if fields.FirstChild != nil {
+		card.AppendChild(fields)
+	}
+	if actions.FirstChild != nil {
+		card.AppendChild(actions)
+	}
+	return card
+}
+
+// 依欄位標題挑選卡片標題欄，找不到時使用第一個有文字且非動作的欄位
+func cardTitleIndex(cells []*html.Node) int {
+	for _, keyword := range cardTitleKeywords {
+		for i, cell := range cells {
+			if strings.Contains(attr(cell, "data-label"), keyword) && cellText(cell) != "" {
+				return i
+			}
+		}
+	}
+	for i, cell := range cells {
+		if cellText(cell) != "" && !isActionCell(cell) {
+			return i
+		}
+	}
+	return -1
+}
+
+// 儲存格的文字全部來自連結或按鈕（例如「查詢」、「列印」）
+func isActionCell(cell *html.Node) bool {
+	if !containsElement(cell, atom.A, atom.Button, atom.Input) {
+		return false
+	}
+	var plain strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.DataAtom == atom.A || n.DataAtom == atom.Button) {
+			return
+		}
+		if n.Type == html.TextNode {
+			plain.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(cell)
+	return strings.TrimSpace(plain.String()) == ""
+}
+
+// 表格中是否有會隨表單送出的欄位（type=button 的按鈕除外）
+func containsFormField(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			switch c.DataAtom {
+			case atom.Select, atom.Textarea:
+				return true
+			case atom.Input:
+				if t := strings.ToLower(attr(c, "type")); t != "button" {
+					return true
+				}
+			case atom.Button:
+				if t := strings.ToLower(attr(c, "type")); t != "button" {
+					return true
+				}
+			}
+		}
+		if containsFormField(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func insideElement(n *html.Node, a atom.Atom) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.DataAtom == a {
+			return true
+		}
+	}
+	return false
+}
+
+// 複製儲存格內容到卡片，移除 id 避免與原始表格重複
+func appendClonedChildren(dst, src *html.Node) {
+	for c := src.FirstChild; c != nil; c = c.NextSibling {
+		dst.AppendChild(cloneNode(c))
+	}
+}
+
+func cloneNode(n *html.Node) *html.Node {
+	clone := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+	}
+	for _, a := range n.Attr {
+		if a.Key != "id" {
+			clone.Attr = append(clone.Attr, a)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		clone.AppendChild(cloneNode(c))
+	}
+	return clone
+}
+
+// 建立元素節點，attrs 依序為 key, value
+func element(a atom.Atom, attrs ...string) *html.Node {
+	n := &html.Node{Type: html.ElementNode, DataAtom: a, Data: a.String()}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		n.Attr = append(n.Attr, html.Attribute{Key: attrs[i], Val: attrs[i+1]})
+	}
+	return n
+}
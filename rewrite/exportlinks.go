@@ -0,0 +1,66 @@
+package rewrite
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 匯出按鈕的格式與顯示文字
+var exportFormats = []struct {
+	format string
+	label  string
+}{
+	{"csv", "⬇ CSV"},
+	{"xlsx", "⬇ Excel"},
+}
+
+// 在每個具有表頭的資料表格前加上匯出按鈕
+//
+// link 依表格序號（與 ExtractTables 的順序相同，從 1 開始）與格式產生下載網址；
+// 沒有可匯出的表格時回傳原始內容。
+func AddTableExportLinks(ctx context.Context, page string, link func(index int, format string) string) string {
+	_, span := tracer.Start(ctx, "addTableExportLinks")
+	defer span.End()
+
+	if !strings.Contains(strings.ToLower(page), "<table") {
+		return page
+	}
+
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		span.RecordError(err)
+		return page
+	}
+
+	added := 0
+	for i, table := range ExtractTables(doc) {
+		if len(table.Labels) == 0 || len(table.Rows) == 0 || table.Node.Parent == nil {
+			continue
+		}
+		bar := element(atom.Div, "class", "myut-table-export")
+		for _, f := range exportFormats {
+			a := element(atom.A, "href", link(i+1, f.format), "download", "", "rel", "nofollow")
+			a.AppendChild(&html.Node{Type: html.TextNode, Data: f.label})
+			bar.AppendChild(a)
+		}
+		table.Node.Parent.InsertBefore(bar, table.Node)
+		added++
+	}
+	span.SetAttributes(attribute.Int("table.export.links", added))
+
+	if added == 0 {
+		return page
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		span.RecordError(err)
+		return page
+	}
+	return buf.String()
+}
@@ -0,0 +1,82 @@
+package rewrite
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 從頁面解析出的表格，供 JSON API 與匯出使用
+type Table struct {
+	Node   *html.Node
+	Labels []string       // 各欄標籤，未偵測到表頭時為 nil
+	Header [][]string     // 表頭列的文字
+	Rows   [][]string     // 資料列的文字，依欄位格線展開；跨欄儲存格只填在第一欄
+	Cells  [][]*html.Node // 與 Rows 對應的儲存格節點，被跨欄或跨列佔用的位置為 nil
+}
+
+// 解析頁面並依文件順序回傳所有表格（含巢狀表格）
+func ParseTables(page string) ([]Table, error) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	return ExtractTables(doc), nil
+}
+
+// 依文件順序取出 DOM 中的所有表格，表頭判斷規則與 AddTableDataLabels 相同
+func ExtractTables(doc *html.Node) []Table {
+	var tables []Table
+	forEachElement(doc, atom.Table, func(table *html.Node) {
+		rows := tableRows(table)
+		if len(rows) == 0 {
+			return
+		}
+
+		grid := layoutRows(rows)
+		width := 0
+		for _, cells := range grid {
+			for _, cell := range cells {
+				width = max(width, cell.col+cell.colspan)
+			}
+		}
+
+		headerCount := 0
+		if len(rows) >= 2 {
+			headerCount = countHeaderRows(table, rows, grid)
+		}
+
+		t := Table{Node: table}
+		if headerCount > 0 {
+			t.Labels = columnLabels(grid[:headerCount])
+			for len(t.Labels) < width {
+				t.Labels = append(t.Labels, "")
+			}
+		}
+		for i, cells := range grid {
+			if len(cells) == 0 {
+				continue
+			}
+			texts := make([]string, width)
+			nodes := make([]*html.Node, width)
+			for _, cell := range cells {
+				texts[cell.col] = cellText(cell.node)
+				nodes[cell.col] = cell.node
+			}
+			if i < headerCount {
+				t.Header = append(t.Header, texts)
+			} else {
+				t.Rows = append(t.Rows, texts)
+				t.Cells = append(t.Cells, nodes)
+			}
+		}
+		tables = append(tables, t)
+	})
+	return tables
+}
+
+// 節點的純文字，規則同表格儲存格（合併空白、略過巢狀表格與腳本）
+func NodeText(n *html.Node) string {
+	return cellText(n)
+}
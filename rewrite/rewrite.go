@@ -0,0 +1,103 @@
+// Package rewrite 負責改寫上游校務系統回傳的內容，讓頁面中的網址指向代理並適合手機瀏覽。
+package rewrite
+
+import (
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("better-myUT/rewrite")
+
+// 將頁面中的上游網址 From 改寫為「代理網址 + To」
+type Rule struct {
+	From string `yaml:"from" toml:"from"`
+	To   string `yaml:"to" toml:"to"`
+}
+
+// 預設改寫規則：my 與 shcourse 兩個子網域的 http/https 網址
+func DefaultRules() []Rule {
+	return []Rule{
+		{From: "https://my.utaipei.edu.tw", To: ""},
+		{From: "http://my.utaipei.edu.tw", To: ""},
+		{From: "https://shcourse.utaipei.edu.tw", To: "/shcourse"},
+		{From: "http://shcourse.utaipei.edu.tw", To: "/shcourse"},
+	}
+}
+
+var (
+	contextMenuRegex = regexp.MustCompile(`(?i)oncontextmenu\s*=\s*["'][^"']*["']`)
+	metaRefreshRegex = regexp.MustCompile(`<meta[^>]*http-equiv="refresh"[^>]*content="[^"]*url=https://my\.utaipei\.edu\.tw([^"]*)"[^>]*>`)
+)
+
+// 將內容中指向上游的網址替換成代理伺服器的網址
+func TargetURLs(html string, proxyHost string, rules []Rule) string {
+	if proxyHost == "" {
+		proxyHost = "http://127.0.0.1:8080"
+	}
+
+	// 將可能寫成 localhost 的 URL 一併導向代理（避免撈取本機 80 port）；
+	// 先於其他規則一次替換完成，以免代理網址本身為 localhost 時被重複替換
+	html = strings.NewReplacer(
+		"https://localhost", proxyHost+"/utaipei",
+		"http://localhost", proxyHost+"/utaipei",
+		"//localhost", proxyHost+"/utaipei",
+	).Replace(html)
+
+	// 替換絕對 URL（規則來自設定，可透過 SIGHUP 重新載入）
+	for _, rule := range rules {
+		html = strings.ReplaceAll(html, rule.From, proxyHost+rule.To)
+	}
+
+	// 處理各種形式的 JavaScript 重定向
+	html = strings.ReplaceAll(html, `window.location.href="https://my.utaipei.edu.tw`, `window.location.href="`+proxyHost)
+	html = strings.ReplaceAll(html, `window.location="https://my.utaipei.edu.tw`, `window.location="`+proxyHost)
+	html = strings.ReplaceAll(html, `location.href="https://my.utaipei.edu.tw`, `location.href="`+proxyHost)
+	html = strings.ReplaceAll(html, `location="https://my.utaipei.edu.tw`, `location="`+proxyHost)
+	html = strings.ReplaceAll(html, `document.location="https://my.utaipei.edu.tw`, `document.location="`+proxyHost)
+	html = strings.ReplaceAll(html, `document.location.href="https://my.utaipei.edu.tw`, `document.location.href="`+proxyHost)
+
+	// 處理單引號的情況
+	html = strings.ReplaceAll(html, `window.location.href='https://my.utaipei.edu.tw`, `window.location.href='`+proxyHost)
+	html = strings.ReplaceAll(html, `window.location='https://my.utaipei.edu.tw`, `window.location='`+proxyHost)
+	html = strings.ReplaceAll(html, `location.href='https://my.utaipei.edu.tw`, `location.href='`+proxyHost)
+	html = strings.ReplaceAll(html, `location='https://my.utaipei.edu.tw`, `location='`+proxyHost)
+
+	// 處理 meta refresh 重定向
+	html = metaRefreshRegex.ReplaceAllStringFunc(html, func(match string) string {
+		return strings.ReplaceAll(match, "https://my.utaipei.edu.tw", proxyHost)
+	})
+
+	// 處理表單 action
+	html = strings.ReplaceAll(html, `action="https://my.utaipei.edu.tw`, `action="`+proxyHost)
+	html = strings.ReplaceAll(html, `action='https://my.utaipei.edu.tw`, `action='`+proxyHost)
+
+	// 處理 iframe src
+	html = strings.ReplaceAll(html, `src="https://my.utaipei.edu.tw`, `src="`+proxyHost)
+	html = strings.ReplaceAll(html, `src='https://my.utaipei.edu.tw`, `src='`+proxyHost)
+
+	// 處理 link href
+	html = strings.ReplaceAll(html, `href="https://my.utaipei.edu.tw`, `href="`+proxyHost)
+	html = strings.ReplaceAll(html, `href='https://my.utaipei.edu.tw`, `href='`+proxyHost)
+
+	// 移除或修改任何可能導致重定向到原站的腳本
+	// 檢查是否有任何 top.location 或 parent.location 的重定向
+	html = strings.ReplaceAll(html, `top.location="https://my.utaipei.edu.tw`, `top.location="`+proxyHost)
+	html = strings.ReplaceAll(html, `parent.location="https://my.utaipei.edu.tw`, `parent.location="`+proxyHost)
+	html = strings.ReplaceAll(html, `top.location='https://my.utaipei.edu.tw`, `top.location='`+proxyHost)
+	html = strings.ReplaceAll(html, `parent.location='https://my.utaipei.edu.tw`, `parent.location='`+proxyHost)
+
+	return html
+}
+
+// 移除右鍵選單禁用
+func StripContextMenu(html string) string {
+	html = strings.ReplaceAll(html, `oncontextmenu="CancelEvent (event, 'oncontextmenu')"`, "")
+	html = strings.ReplaceAll(html, `oncontextmenu='CancelEvent (event, "oncontextmenu")'`, "")
+	html = strings.ReplaceAll(html, `oncontextmenu="return false"`, "")
+	html = strings.ReplaceAll(html, `oncontextmenu='return false'`, "")
+
+	// 移除可能的右鍵禁用 JavaScript
+	return contextMenuRegex.ReplaceAllString(html, "")
+}
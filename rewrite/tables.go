@@ -0,0 +1,407 @@
+package rewrite
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 表頭列最多幾列（例如「成績」跨欄下再分「期中 / 期末」）
+const maxHeaderRows = 3
+
+// 表頭列常見的 class 關鍵字
+var headerClassKeywords = []string{"head", "title", "caption"}
+
+// 為表格的 td 添加 data-label 屬性以支援響應式設計
+//
+// 以 DOM 解析頁面，逐一處理每個表格（含巢狀表格），依下列規則判斷表頭列：
+//   - <thead> 中的列
+//   - 表格開頭全為 <th>、class 含 head/title/caption，或文字全為粗體的列
+//   - .stable 表格的第一列（校務系統清單表格多以 <tr><td> 當表頭）
+//
+// 表頭與資料列都依 colspan / rowspan 對應到實際欄位；沒有任何儲存格需要標註時回傳原始內容。
+func AddTableDataLabels(ctx context.Context, page string) string {
+	_, span := tracer.Start(ctx, "addTableDataLabels")
+	defer span.End()
+
+	if !strings.Contains(strings.ToLower(page), "<table") {
+		return page
+	}
+
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		span.RecordError(err)
+		return page
+	}
+
+	labelled := 0
+	forEachElement(doc, atom.Table, func(table *html.Node) {
+		labelled += labelTable(table)
+	})
+	span.SetAttributes(attribute.Int("table.cells.labelled", labelled))
+
+	if labelled == 0 {
+		return page
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		span.RecordError(err)
+		return page
+	}
+	return buf.String()
+}
+
+// 表格中的一列
+type tableRow struct {
+	node    *html.Node
+	section atom.Atom // thead / tbody / tfoot，直接位於 table 下時為 0
+}
+
+// 依 colspan / rowspan 放到欄位格線上的儲存格
+type placedCell struct {
+	node    *html.Node
+	col     int
+	colspan int
+}
+
+// 為單一表格標註，回傳標註的儲存格數
+func labelTable(table *html.Node) int {
+	rows := tableRows(table)
+	if len(rows) < 2 {
+		return 0
+	}
+
+	grid := layoutRows(rows)
+	headerCount := countHeaderRows(table, rows, grid)
+	if headerCount == 0 || headerCount >= len(rows) {
+		return 0
+	}
+
+	labels := columnLabels(grid[:headerCount])
+	if len(labels) < 2 {
+		return 0
+	}
+
+	labelled := 0
+	for _, cells := range grid[headerCount:] {
+		for _, cell := range cells {
+			if cell.node.DataAtom != atom.Td || hasAttr(cell.node, "data-label") {
+				continue
+			}
+			if label := spanLabel(labels, cell.col, cell.colspan); label != "" {
+				cell.node.Attr = append(cell.node.Attr, html.Attribute{Key: "data-label", Val: label})
+				labelled++
+			}
+		}
+	}
+	return labelled
+}
+
+// 取出表格本身的列（不含巢狀表格中的列）
+func tableRows(table *html.Node) []tableRow {
+	var rows []tableRow
+	for c := table.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.DataAtom {
+		case atom.Tr:
+			rows = append(rows, tableRow{node: c})
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			for r := c.FirstChild; r != nil; r = r.NextSibling {
+				if r.Type == html.ElementNode && r.DataAtom == atom.Tr {
+					rows = append(rows, tableRow{node: r, section: c.DataAtom})
+				}
+			}
+		}
+	}
+	return rows
+}
+
+// 將每列的儲存格依 colspan / rowspan 放到欄位格線上
+func layoutRows(rows []tableRow) [][]placedCell {
+	grid := make([][]placedCell, len(rows))
+	var carry []int // 各欄仍被上方 rowspan 佔用的列數
+
+	for i, row := range rows {
+		col := 0
+		for c := row.node.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || (c.DataAtom != atom.Td && c.DataAtom != atom.Th) {
+				continue
+			}
+			for col < len(carry) && carry[col] > 0 {
+				col++
+			}
+
+			colspan := spanAttr(c, "colspan")
+			rowspan := spanAttr(c, "rowspan")
+			grid[i] = append(grid[i], placedCell{node: c, col: col, colspan: colspan})
+
+			for len(carry) < col+colspan {
+				carry = append(carry, 0)
+			}
+			for k := col; k < col+colspan; k++ {
+				carry[k] = rowspan
+			}
+			col += colspan
+		}
+
+		// 本列結束，上方 rowspan 往下少佔一列
+		for k := range carry {
+			if carry[k] > 0 {
+				carry[k]--
+			}
+		}
+	}
+	return grid
+}
+
+// 判斷表格開頭有幾列是表頭
+func countHeaderRows(table *html.Node, rows []tableRow, grid [][]placedCell) int {
+	theadRows := 0
+	for _, row := range rows {
+		if row.section == atom.Thead {
+			theadRows++
+		}
+	}
+	if theadRows > 0 {
+		// thead 不在最前面時（極少見）無法對應，略過
+		for i := 0; i < theadRows; i++ {
+			if rows[i].section != atom.Thead {
+				return 0
+			}
+		}
+		return theadRows
+	}
+
+	count := 0
+	for count < len(rows) && count < maxHeaderRows && isHeaderRow(rows[count].node, grid[count]) {
+		count++
+	}
+
+	if count == 0 && hasClass(table, "stable") && isPlainRow(grid[0]) {
+		count = 1
+	}
+	return count
+}
+
+// 全為 th、class 像表頭，或文字全為粗體的列
+func isHeaderRow(tr *html.Node, cells []placedCell) bool {
+	if len(cells) == 0 {
+		return false
+	}
+
+	allTh, allBold, allHeaderClass := true, true, true
+	for _, cell := range cells {
+		if cell.node.DataAtom != atom.Th {
+			allTh = false
+		}
+		if !isHeaderClass(cell.node) {
+			allHeaderClass = false
+		}
+		if cellText(cell.node) != "" && !isBold(cell.node, false) {
+			allBold = false
+		}
+	}
+	if allTh || allHeaderClass || isHeaderClass(tr) {
+		return true
+	}
+	return allBold && isPlainRow(cells)
+}
+
+// 只有文字、沒有表單元件或連結的列，且至少有兩格有文字
+func isPlainRow(cells []placedCell) bool {
+	withText := 0
+	for _, cell := range cells {
+		if containsElement(cell.node, atom.Input, atom.Select, atom.Textarea, atom.Button, atom.A, atom.Table) {
+			return false
+		}
+		if cellText(cell.node) != "" {
+			withText++
+		}
+	}
+	return withText >= 2
+}
+
+// 由表頭列計算各欄標籤，多列表頭以「 / 」串接（例如「成績 / 期中」）
+func columnLabels(headerRows [][]placedCell) []string {
+	var parts [][]string
+	for _, cells := range headerRows {
+		for _, cell := range cells {
+			text := cellText(cell.node)
+			for k := cell.col; k < cell.col+cell.colspan; k++ {
+				for len(parts) <= k {
+					parts = append(parts, nil)
+				}
+				if text != "" && (len(parts[k]) == 0 || parts[k][len(parts[k])-1] != text) {
+					parts[k] = append(parts[k], text)
+				}
+			}
+		}
+	}
+
+	labels := make([]string, len(parts))
+	for i, p := range parts {
+		labels[i] = strings.Join(p, " / ")
+	}
+	return labels
+}
+
+// 跨欄儲存格取所涵蓋欄位的不重複標籤；各欄有共同的上層表頭時只取上層（例如「成績 / 期中」與「成績 / 期末」取「成績」）
+func spanLabel(labels []string, col, colspan int) string {
+	var parts []string
+	for k := col; k < col+colspan && k < len(labels); k++ {
+		if labels[k] == "" || (len(parts) > 0 && parts[len(parts)-1] == labels[k]) {
+			continue
+		}
+		parts = append(parts, labels[k])
+	}
+	if len(parts) > 1 {
+		if common := commonLabelPrefix(parts); common != "" {
+			return common
+		}
+	}
+	return strings.Join(parts, " / ")
+}
+
+// 多個「上層 / 下層」標籤共同的上層部分
+func commonLabelPrefix(labels []string) string {
+	common := strings.Split(labels[0], " / ")
+	for _, label := range labels[1:] {
+		segments := strings.Split(label, " / ")
+		n := 0
+		for n < len(common) && n < len(segments) && common[n] == segments[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return strings.Join(common, " / ")
+}
+
+// 儲存格的純文字，合併連續空白（含 &nbsp;），不含巢狀表格與腳本
+func cellText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+		case n.Type == html.ElementNode && (n.DataAtom == atom.Table || n.DataAtom == atom.Script || n.DataAtom == atom.Style):
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// 所有文字是否都在 b / strong / th 或 font-weight: bold 之內
+func isBold(n *html.Node, bold bool) bool {
+	if n.Type == html.TextNode {
+		return bold || strings.TrimSpace(n.Data) == ""
+	}
+	if n.Type == html.ElementNode {
+		switch n.DataAtom {
+		case atom.B, atom.Strong, atom.Th:
+			bold = true
+		}
+		if style := strings.ToLower(attr(n, "style")); strings.Contains(style, "font-weight:bold") ||
+			strings.Contains(style, "font-weight: bold") {
+			bold = true
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !isBold(c, bold) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHeaderClass(n *html.Node) bool {
+	class := strings.ToLower(attr(n, "class"))
+	if class == "" {
+		return false
+	}
+	for _, keyword := range headerClassKeywords {
+		if strings.Contains(class, keyword) {
+			return true
+		}
+	}
+	for _, name := range strings.Fields(class) {
+		if name == "th" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, name := range strings.Fields(attr(n, "class")) {
+		if strings.EqualFold(name, class) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsElement(n *html.Node, atoms ...atom.Atom) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			for _, a := range atoms {
+				if c.DataAtom == a {
+					return true
+				}
+			}
+		}
+		if containsElement(c, atoms...) {
+			return true
+		}
+	}
+	return false
+}
+
+func forEachElement(n *html.Node, a atom.Atom, fn func(*html.Node)) {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		fn(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		forEachElement(c, a, fn)
+	}
+}
+
+// colspan / rowspan，缺少或不合法時為 1；rowspan="0" 依規格視為 1 處理
+func spanAttr(n *html.Node, key string) int {
+	v, err := strconv.Atoi(strings.TrimSpace(attr(n, key)))
+	if err != nil || v < 1 {
+		return 1
+	}
+	return min(v, 1000)
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
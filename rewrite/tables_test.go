@@ -0,0 +1,149 @@
+package rewrite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func TestAddTableDataLabels(t *testing.T) {
+	tests := []struct {
+		fixture string
+		// 各表格（依 id）每一列資料儲存格的 data-label，沒有標註時為空字串
+		want map[string][][]string
+	}{
+		{
+			fixture: "stable_list.html",
+			want: map[string][][]string{
+				"list": {
+					{"", "", "", "", "", ""},
+					{"序號", "選課代號", "科目名稱", "學分", `備註 (含"停修" & <加退選>)`, ""},
+					{"序號", "選課代號", "科目名稱", "學分", `備註 (含"停修" & <加退選>)`, ""},
+				},
+			},
+		},
+		{
+			fixture: "grouped_header.html",
+			want: map[string][][]string{
+				"grades": {
+					{"", "", "", ""},
+					{"", ""},
+					{"科目代碼", "科目名稱", "成績 / 期中", "成績 / 期末", "學分"},
+					// 跨欄儲存格取共同的上層表頭
+					{"科目代碼", "科目名稱", "成績", "學分"},
+					{"科目代碼", "科目名稱", "成績 / 期中", "成績 / 期末", "學分"},
+					// 第一欄被上一列的 rowspan 佔用，其餘儲存格往右對應
+					{"科目名稱", "成績 / 期中", "成績 / 期末", "學分"},
+				},
+			},
+		},
+		{
+			fixture: "nested_layout.html",
+			want: map[string][][]string{
+				// 單欄的版面表格不標註
+				"layout": {{""}, {""}, {""}},
+				// 含巢狀表格的儲存格依外層表格的欄位標註
+				"schedule": {
+					{},
+					{"節次", "星期一", "星期二"},
+					{"節次", "星期一", "星期二"},
+				},
+				// 沒有表頭的巢狀表格不標註
+				"detail": {{"", ""}, {"", ""}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			page := readFixture(t, tt.fixture)
+			out := AddTableDataLabels(context.Background(), page)
+
+			doc, err := html.Parse(strings.NewReader(out))
+			if err != nil {
+				t.Fatalf("解析輸出失敗: %v", err)
+			}
+			for id, want := range tt.want {
+				table := findByID(doc, id)
+				if table == nil {
+					t.Fatalf("找不到表格 %s", id)
+				}
+				if got := rowLabels(table); !reflect.DeepEqual(got, want) {
+					t.Errorf("表格 %s 的 data-label\n got: %q\nwant: %q", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddTableDataLabelsEscapesLabels(t *testing.T) {
+	out := AddTableDataLabels(context.Background(), readFixture(t, "stable_list.html"))
+
+	want := `data-label="備註 (含&#34;停修&#34; &amp; &lt;加退選&gt;)"`
+	if got := strings.Count(out, want); got != 2 {
+		t.Errorf("跳脫後的標籤出現 %d 次，預期 2 次\n%s", got, out)
+	}
+	if strings.Contains(out, `data-label="備註 (含"`) {
+		t.Errorf("標籤中的引號未跳脫")
+	}
+}
+
+func TestAddTableDataLabelsUnchanged(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+	}{
+		{"查詢表單", readFixture(t, "query_form.html")},
+		{"沒有表格", "<html><body><p>沒有資料</p></body></html>"},
+		{"只有表頭", "<table><tr><th>科目</th><th>成績</th></tr></table>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AddTableDataLabels(context.Background(), tt.page); got != tt.page {
+				t.Errorf("沒有可標註的儲存格時應回傳原始內容，得到\n%s", got)
+			}
+		})
+	}
+}
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func findByID(n *html.Node, id string) *html.Node {
+	if n.Type == html.ElementNode && attr(n, "id") == id {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findByID(c, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// 表格本身各列 td 的 data-label（不含巢狀表格）
+func rowLabels(table *html.Node) [][]string {
+	var labels [][]string
+	for _, row := range tableRows(table) {
+		cells := []string{}
+		for c := row.node.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.DataAtom == atom.Td {
+				cells = append(cells, attr(c, "data-label"))
+			}
+		}
+		labels = append(labels, cells)
+	}
+	return labels
+}
@@ -0,0 +1,293 @@
+package rewrite
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 經過轉換管線的上游回應
+type Page struct {
+	Request     *http.Request // 瀏覽器送來的原始請求
+	Path        string
+	ContentType string
+	Status      int // 上游回應狀態碼
+	Body        string
+}
+
+// 頁面轉換器：依路徑與內容類型決定是否套用，並依 Order 由小到大執行
+type Transformer interface {
+	Name() string
+	Order() int
+	Match(path, contentType string) bool
+	Transform(ctx context.Context, page *Page) error
+}
+
+// 實作此介面且回傳 false 的轉換器預設停用，需在設定中明確啟用
+type DefaultEnabler interface {
+	EnabledByDefault() bool
+}
+
+// 以函數實作的轉換器
+type Stage struct {
+	ID       string
+	Priority int
+	Matcher  Matcher // nil 表示套用到所有回應
+	Optional bool    // 預設停用
+	Fn       func(ctx context.Context, page *Page) error
+}
+
+func (s Stage) Name() string { return s.ID }
+func (s Stage) Order() int   { return s.Priority }
+
+func (s Stage) Match(path, contentType string) bool {
+	return s.Matcher == nil || s.Matcher(path, contentType)
+}
+
+func (s Stage) Transform(ctx context.Context, page *Page) error {
+	return s.Fn(ctx, page)
+}
+
+func (s Stage) EnabledByDefault() bool { return !s.Optional }
+
+// 依請求路徑與回應內容類型判斷是否套用
+type Matcher func(path, contentType string) bool
+
+// 路徑以任一字尾結尾（不分大小寫）
+func PathSuffix(suffixes ...string) Matcher {
+	return func(path, _ string) bool {
+		path = strings.ToLower(path)
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(path, strings.ToLower(suffix)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// 路徑包含任一子字串（不分大小寫）
+func PathContains(parts ...string) Matcher {
+	return func(path, _ string) bool {
+		path = strings.ToLower(path)
+		for _, part := range parts {
+			if strings.Contains(path, strings.ToLower(part)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// 內容類型包含任一子字串（不分大小寫），例如 "text/html"、"javascript"
+func ContentType(types ...string) Matcher {
+	return func(_, contentType string) bool {
+		contentType = strings.ToLower(contentType)
+		for _, t := range types {
+			if strings.Contains(contentType, strings.ToLower(t)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// 所有條件皆成立
+func All(matchers ...Matcher) Matcher {
+	return func(path, contentType string) bool {
+		for _, m := range matchers {
+			if !m(path, contentType) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// 任一條件成立
+func AnyOf(matchers ...Matcher) Matcher {
+	return func(path, contentType string) bool {
+		for _, m := range matchers {
+			if m(path, contentType) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// 條件不成立
+func Not(m Matcher) Matcher {
+	return func(path, contentType string) bool {
+		return !m(path, contentType)
+	}
+}
+
+// 轉換器註冊表，可在執行期間切換各轉換器的啟用狀態
+type Registry struct {
+	mu           sync.RWMutex
+	transformers []Transformer
+	enabled      atomic.Pointer[map[string]bool] // nil 表示全部使用預設值
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// 註冊轉換器，名稱重複時取代舊的；相同 Order 者依註冊順序執行
+func (r *Registry) Register(transformers ...Transformer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range transformers {
+		replaced := false
+		for i, existing := range r.transformers {
+			if existing.Name() == t.Name() {
+				r.transformers[i] = t
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			r.transformers = append(r.transformers, t)
+		}
+	}
+
+	sort.SliceStable(r.transformers, func(i, j int) bool {
+		return r.transformers[i].Order() < r.transformers[j].Order()
+	})
+}
+
+// 設定額外啟用與停用的轉換器（停用優先），名稱不存在時回傳錯誤且不變更目前狀態
+func (r *Registry) Configure(enable, disable []string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	known := map[string]bool{}
+	for _, t := range r.transformers {
+		known[t.Name()] = true
+	}
+
+	state := map[string]bool{}
+	for _, t := range r.transformers {
+		state[t.Name()] = enabledByDefault(t)
+	}
+
+	var unknown []string
+	for _, name := range enable {
+		if !known[name] {
+			unknown = append(unknown, name)
+			continue
+		}
+		state[name] = true
+	}
+	for _, name := range disable {
+		if !known[name] {
+			unknown = append(unknown, name)
+			continue
+		}
+		state[name] = false
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("未知的頁面轉換器: %s（可用: %s）", strings.Join(unknown, ", "), strings.Join(r.names(), ", "))
+	}
+
+	r.enabled.Store(&state)
+	return nil
+}
+
+// 依執行順序列出轉換器名稱與啟用狀態
+func (r *Registry) List() []TransformerInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]TransformerInfo, 0, len(r.transformers))
+	for _, t := range r.transformers {
+		infos = append(infos, TransformerInfo{Name: t.Name(), Order: t.Order(), Enabled: r.isEnabled(t)})
+	}
+	return infos
+}
+
+// 轉換器狀態
+type TransformerInfo struct {
+	Name    string `json:"name"`
+	Order   int    `json:"order"`
+	Enabled bool   `json:"enabled"`
+}
+
+// 依序套用所有啟用且符合的轉換器，回傳實際套用的轉換器名稱
+//
+// 單一轉換器失敗時記錄錯誤並還原該轉換器的修改，其餘轉換器照常執行。
+func (r *Registry) Apply(ctx context.Context, page *Page) []string {
+	r.mu.RLock()
+	transformers := append([]Transformer(nil), r.transformers...)
+	r.mu.RUnlock()
+
+	var applied []string
+	for _, t := range transformers {
+		if !r.isEnabled(t) || !t.Match(page.Path, page.ContentType) {
+			continue
+		}
+
+		spanCtx, span := tracer.Start(ctx, "transform "+t.Name(), trace.WithAttributes(
+			attribute.String("url.path", page.Path),
+			attribute.Int("html.input.size", len(page.Body)),
+		))
+		before := page.Body
+		if err := t.Transform(spanCtx, page); err != nil {
+			page.Body = before
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "頁面轉換失敗")
+			log.Printf("⚠️  頁面轉換器 %s 失敗，略過: %v", t.Name(), err)
+			span.End()
+			continue
+		}
+		span.End()
+		applied = append(applied, t.Name())
+	}
+	return applied
+}
+
+func (r *Registry) isEnabled(t Transformer) bool {
+	if state := r.enabled.Load(); state != nil {
+		if enabled, ok := (*state)[t.Name()]; ok {
+			return enabled
+		}
+	}
+	return enabledByDefault(t)
+}
+
+func (r *Registry) names() []string {
+	names := make([]string, 0, len(r.transformers))
+	for _, t := range r.transformers {
+		names = append(names, t.Name())
+	}
+	return names
+}
+
+func enabledByDefault(t Transformer) bool {
+	if d, ok := t.(DefaultEnabler); ok {
+		return d.EnabledByDefault()
+	}
+	return true
+}
+
+// 拆解逗號分隔的設定清單，去除各項前後空白並略過空項目
+func SplitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
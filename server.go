@@ -0,0 +1,132 @@
+package main
+
+import (
+	"better-myUT/proxy"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// systemd socket activation 傳入的第一個檔案描述子
+const systemdListenFDStart = 3
+
+// 程式結束前要依序執行的清理工作（例如送出追蹤資料、寫回 session store）
+type shutdownHook struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// 建立監聽 socket
+//
+// 優先使用 systemd socket activation 傳入的 socket（LISTEN_FDS），讓 systemd
+// 在重啟期間替我們保留連線；否則在 reusePort 開啟時以 SO_REUSEPORT
+// 監聽，讓新舊行程可同時綁定同一個埠進行交接。
+func listen(addr string, reusePort bool) (net.Listener, error) {
+	if l, err := systemdListener(); err != nil {
+		return nil, err
+	} else if l != nil {
+		log.Printf("使用 systemd socket activation 傳入的 socket: %s", l.Addr())
+		return l, nil
+	}
+
+	if reusePort {
+		l, err := listenReusePort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("以 SO_REUSEPORT 監聽失敗: %w", err)
+		}
+		log.Printf("以 SO_REUSEPORT 監聽 %s", l.Addr())
+		return l, nil
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// 取得 systemd socket activation 傳入的 listener，未啟用時回傳 nil
+func systemdListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+	if count > 1 {
+		log.Printf("警告：systemd 傳入 %d 個 socket，只使用第一個", count)
+	}
+
+	// 避免子行程重複繼承
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(systemdListenFDStart), "systemd-listen-fd")
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("無法使用 systemd 傳入的 socket: %w", err)
+	}
+	return l, nil
+}
+
+// 啟動伺服器並等待 SIGINT/SIGTERM，收到訊號後停止接受新連線、
+// 在期限內排空進行中的代理請求（例如學生的選課 POST），最後執行清理工作
+func runServer(srv *http.Server, l net.Listener, myUTProxy *proxy.Server, drainTimeout time.Duration, hooks []shutdownHook) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			// 憑證由 TLSConfig.GetCertificate 提供，ServeTLS 會一併設定 HTTP/2
+			log.Printf("伺服器開始以 HTTPS 監聽 %s", l.Addr())
+			serveErr <- srv.ServeTLS(l, "", "")
+			return
+		}
+		log.Printf("伺服器開始監聽 %s", l.Addr())
+		serveErr <- srv.Serve(l)
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+	case <-ctx.Done():
+		stop()
+		log.Printf("🛑 收到結束訊號，停止接受新連線並排空進行中的請求（最多 %s）", drainTimeout)
+
+		// 讓 /readyz 立即回報未就緒，前端負載平衡器可停止導入流量
+		myUTProxy.Drain()
+
+		drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		if shutdownErr := srv.Shutdown(drainCtx); shutdownErr != nil {
+			log.Printf("⚠️  排空請求逾時，強制關閉剩餘連線: %v", shutdownErr)
+			srv.Close()
+		} else {
+			log.Printf("✅ 所有進行中的請求已完成")
+		}
+		cancel()
+	}
+
+	// 清理工作各自給予獨立的期限，避免排空逾時後無法送出資料
+	for _, hook := range hooks {
+		hookCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if hookErr := hook.fn(hookCtx); hookErr != nil {
+			log.Printf("關閉 %s 失敗: %v", hook.name, hookErr)
+		}
+		cancel()
+	}
+
+	return err
+}
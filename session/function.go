@@ -0,0 +1,84 @@
+package session
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// 功能頁路徑：/utaipei/<系統>_pro/<功能代碼>.jsp，例如 /utaipei/ag_pro/ag008.jsp 對應 AG008
+var functionPathRegex = regexp.MustCompile(`(?i)^/utaipei/([a-z0-9]+_pro)/([a-z0-9_]+)\.jsp$`)
+
+// 功能名稱的最大字數
+const maxNameLength = 60
+
+// 功能代碼：系統代號（英文字母）接數字，例如 AG008、SS101A
+var functionCodeRegex = regexp.MustCompile(`^([A-Za-z]+)[0-9][0-9A-Za-z_]*$`)
+
+var titleRegex = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// 依請求網址判斷是否為功能頁，回傳功能代碼（大寫）
+func FunctionCode(u *url.URL) (string, bool) {
+	m := functionPathRegex.FindStringSubmatch(u.Path)
+	if m == nil {
+		return "", false
+	}
+	return strings.ToUpper(m[2]), true
+}
+
+// 依命名慣例由功能代碼推得功能頁路徑（FunctionCode 的反向），例如 AG008 → /utaipei/ag_pro/ag008.jsp
+func FunctionPath(code string) (string, bool) {
+	m := functionCodeRegex.FindStringSubmatch(code)
+	if m == nil {
+		return "", false
+	}
+	return "/utaipei/" + strings.ToLower(m[1]) + "_pro/" + strings.ToLower(code) + ".jsp", true
+}
+
+// 由功能頁網址與頁面內容建立功能紀錄，名稱取自 <title>，沒有時使用功能代碼
+func FunctionFromPage(u *url.URL, page string) (Function, bool) {
+	code, ok := FunctionCode(u)
+	if !ok {
+		return Function{}, false
+	}
+	name := code
+	if m := titleRegex.FindStringSubmatch(page); m != nil {
+		if title := strings.Join(strings.Fields(m[1]), " "); title != "" {
+			name = title
+		}
+	}
+	return Function{Code: code, Name: name, Path: u.RequestURI()}, true
+}
+
+// 功能代碼與路徑是否相符，避免把任意網址存成常用功能
+func ValidFunction(fn Function) bool {
+	u, err := url.Parse(fn.Path)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return false
+	}
+	code, ok := FunctionCode(u)
+	return ok && strings.EqualFold(code, fn.Code)
+}
+
+// 從登入表單取出學號：依序尋找 fields 中第一個有值的欄位
+func StudentFromForm(form url.Values, fields []string) string {
+	for _, field := range fields {
+		if v := strings.TrimSpace(form.Get(field)); v != "" {
+			return strings.ToUpper(v)
+		}
+	}
+	return ""
+}
+
+// 統一功能代碼大小寫，並限制名稱長度
+func normalizeFunction(fn Function) Function {
+	fn.Code = strings.ToUpper(fn.Code)
+	fn.Name = strings.Join(strings.Fields(fn.Name), " ")
+	if runes := []rune(fn.Name); len(runes) > maxNameLength {
+		fn.Name = string(runes[:maxNameLength])
+	}
+	if fn.Name == "" {
+		fn.Name = fn.Code
+	}
+	return fn
+}
@@ -0,0 +1,475 @@
+// Package session 保存代理端的 session 資料：上游 session（JSESSIONID）的登入狀態與登入的學號、姓名，
+// 以及每位學生的常用功能、最近使用紀錄與最近一次的課表。
+//
+// session 狀態只存在記憶體中；常用功能與最近使用紀錄可另外寫入 JSON 檔案，重啟後保留。
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 上游校務系統的 session cookie 名稱
+	CookieName = "JSESSIONID"
+
+	MaxFavorites = 50 // 每位學生最多的常用功能數
+	MaxRecent    = 10 // 每位學生保留的最近使用數
+
+	sessionTTL  = 12 * time.Hour // 超過此時間未使用的 session 紀錄會被清除
+	maxSessions = 10000          // 記憶體中最多保留的 session 紀錄數
+)
+
+var (
+	ErrNotBound          = errors.New("session 尚未對應到學號，請重新登入")
+	ErrTooManyFavorites  = fmt.Errorf("常用功能最多 %d 項", MaxFavorites)
+	ErrFavoriteNotFound  = errors.New("常用功能不存在")
+	errInvalidFunctionID = errors.New("功能代碼或路徑不合法")
+)
+
+// 校務系統的一個功能
+type Function struct {
+	Code string    `json:"code"`
+	Name string    `json:"name"`
+	Path string    `json:"path"`
+	Time time.Time `json:"time"` // 加入常用或最後使用的時間
+}
+
+// 學生的常用功能與最近使用紀錄，皆以新到舊排列
+type Profile struct {
+	Favorites []Function `json:"favorites"`
+	Recent    []Function `json:"recent"`
+
+	// 最近一次取得的課表（JSON），供行事曆訂閱在沒有 session 時使用
+	Timetable        json.RawMessage `json:"timetable,omitempty"`
+	TimetableUpdated time.Time       `json:"timetableUpdated,omitzero"`
+}
+
+// 上游 session 的登入狀態
+type State string
+
+const (
+	StateUnknown  State = "unknown"   // 代理尚未看過足以判斷的回應
+	StateLoggedIn State = "logged_in" // 最近一次回應為登入後才看得到的頁面
+	StateExpired  State = "expired"   // 最近一次回應要求重新登入或被導向登入頁
+)
+
+// 代理對某個上游 session 所知的資訊
+type Info struct {
+	Student  string    // 學號，未知時為空字串
+	Pending  string    // 登入表單送出的學號，待登入後的頁面確認
+	Name     string    // 姓名，未知時為空字串
+	State    State     // 登入狀態
+	Since    time.Time // 代理第一次看到此 session 登入的時間
+	LastSeen time.Time // 最近一次經代理使用的時間
+}
+
+// 檔案格式
+type snapshot struct {
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+// 代理端的 session store，可並行使用
+type Store struct {
+	file    string     // 空字串表示只存在記憶體中
+	flushMu sync.Mutex // 避免同時寫回時較舊的內容覆蓋較新的內容
+
+	mu       sync.Mutex
+	sessions map[string]*Info
+	profiles map[string]*Profile
+	dirty    bool
+	flushErr error // 最近一次寫回的錯誤，供就緒檢查回報
+}
+
+// 開啟 session store，file 不為空時從檔案載入既有紀錄（檔案不存在視為空白）
+func Open(file string) (*Store, error) {
+	s := &Store{
+		file:     file,
+		sessions: make(map[string]*Info),
+		profiles: make(map[string]*Profile),
+	}
+	if file == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("讀取 session store 檔案失敗: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("解析 session store 檔案 %s 失敗: %w", file, err)
+	}
+	for student, profile := range snap.Profiles {
+		if profile != nil {
+			s.profiles[student] = profile
+		}
+	}
+	log.Printf("📂 已載入 session store: %d 位學生的常用功能", len(s.profiles))
+	return s, nil
+}
+
+// 取得請求的上游 session ID（JSESSIONID），沒有時回傳空字串
+func ID(r *http.Request) string {
+	for _, cookie := range r.Cookies() {
+		if strings.EqualFold(cookie.Name, CookieName) && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// 記錄登入表單送出的學號，待 Identify 由登入後的頁面確認；與已知學號不同時先清除舊的對應
+func (s *Store) Expect(sessionID, student string) {
+	if sessionID == "" || student == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := s.entryLocked(sessionID, time.Now())
+	if info.Student != student {
+		info.Student = ""
+		info.Name = ""
+	}
+	info.Pending = student
+}
+
+// 以頁面解析出的學號確認登入表單送出的學號，並補上姓名；回傳是否確認了學號
+//
+// 學號只由登入表單取得：頁面的學號與 Pending 相符才對應到 session，不符時放棄這次登入的學號。
+// 頁面可能是名冊或他人的資料，因此沒有待確認的學號時，頁面上的學號一律不採用，只在與已知學號相符時補上姓名。
+func (s *Store) Identify(sessionID, student, name string) bool {
+	if sessionID == "" || (student == "" && name == "") {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.sessions[sessionID]
+	if !ok {
+		return false
+	}
+
+	confirmed := false
+	if info.Pending != "" && student != "" {
+		if !strings.EqualFold(info.Pending, student) {
+			log.Printf("⚠️  登入後頁面的學號與登入表單不符，不記錄學號")
+			info.Pending = ""
+			return false
+		}
+		info.Student = info.Pending
+		info.Pending = ""
+		s.setStateLocked(info, StateLoggedIn)
+		confirmed = true
+	}
+	if info.Student != "" && info.Name == "" && (student == "" || strings.EqualFold(student, info.Student)) {
+		info.Name = name
+	}
+	return confirmed
+}
+
+// 記錄由上游回應判斷出的登入狀態；未看過的 session 只在已登入時建立紀錄
+func (s *Store) Observe(sessionID string, state State) {
+	if sessionID == "" || state == StateUnknown {
+		return
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.sessions[sessionID]
+	if !ok {
+		if state != StateLoggedIn {
+			return
+		}
+		info = s.entryLocked(sessionID, now)
+	}
+	info.LastSeen = now
+	s.setStateLocked(info, state)
+}
+
+// 重新登入時重新計算 session 時長
+func (s *Store) setStateLocked(info *Info, state State) {
+	if state == StateLoggedIn && info.State != StateLoggedIn {
+		info.Since = info.LastSeen
+	}
+	info.State = state
+}
+
+func (s *Store) entryLocked(sessionID string, now time.Time) *Info {
+	info, ok := s.sessions[sessionID]
+	if ok {
+		info.LastSeen = now
+		return info
+	}
+	if len(s.sessions) >= maxSessions {
+		s.pruneLocked(now)
+	}
+	info = &Info{State: StateUnknown, Since: now, LastSeen: now}
+	s.sessions[sessionID] = info
+	return info
+}
+
+// 取得 session 的資訊（複本），超過保留時間未使用的 session 視為不存在
+func (s *Store) Info(sessionID string) (Info, bool) {
+	if sessionID == "" {
+		return Info{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.sessions[sessionID]
+	if !ok {
+		return Info{}, false
+	}
+	if time.Since(info.LastSeen) > sessionTTL {
+		delete(s.sessions, sessionID)
+		return Info{}, false
+	}
+	return *info, true
+}
+
+// 取得 session 登入的學號
+func (s *Store) Student(sessionID string) (string, bool) {
+	if sessionID == "" {
+		return "", false
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.sessions[sessionID]
+	if !ok || info.Student == "" {
+		return "", false
+	}
+	if now.Sub(info.LastSeen) > sessionTTL {
+		delete(s.sessions, sessionID)
+		return "", false
+	}
+	info.LastSeen = now
+	return info.Student, true
+}
+
+// 清除過期的 session 紀錄；仍超過上限時移除最久未使用的一半
+func (s *Store) pruneLocked(now time.Time) {
+	for id, info := range s.sessions {
+		if now.Sub(info.LastSeen) > sessionTTL {
+			delete(s.sessions, id)
+		}
+	}
+	if len(s.sessions) < maxSessions {
+		return
+	}
+	ids := make([]string, 0, len(s.sessions))
+	for id := range s.sessions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return s.sessions[ids[i]].LastSeen.Before(s.sessions[ids[j]].LastSeen)
+	})
+	for _, id := range ids[:len(ids)-maxSessions/2] {
+		delete(s.sessions, id)
+	}
+}
+
+// 取得學生的常用功能與最近使用紀錄（複本）
+func (s *Store) Profile(student string) Profile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.profiles[student]
+	if p == nil {
+		return Profile{Favorites: []Function{}, Recent: []Function{}}
+	}
+	return Profile{
+		Favorites: append([]Function{}, p.Favorites...),
+		Recent:    append([]Function{}, p.Recent...),
+	}
+}
+
+// 加入常用功能；已存在時更新名稱並移到最前面
+func (s *Store) AddFavorite(student string, fn Function) error {
+	if !ValidFunction(fn) {
+		return errInvalidFunctionID
+	}
+	fn = normalizeFunction(fn)
+	fn.Time = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.profileLocked(student)
+	rest, existed := without(p.Favorites, fn.Code)
+	if !existed && len(rest) >= MaxFavorites {
+		return ErrTooManyFavorites
+	}
+	p.Favorites = append([]Function{fn}, rest...)
+	s.dirty = true
+	return nil
+}
+
+// 移除常用功能
+func (s *Store) RemoveFavorite(student, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.profiles[student]
+	if p == nil {
+		return ErrFavoriteNotFound
+	}
+	rest, existed := without(p.Favorites, code)
+	if !existed {
+		return ErrFavoriteNotFound
+	}
+	p.Favorites = rest
+	s.dirty = true
+	return nil
+}
+
+// 記錄學生使用了某功能
+func (s *Store) RecordVisit(student string, fn Function) {
+	if student == "" || !ValidFunction(fn) {
+		return
+	}
+	fn = normalizeFunction(fn)
+	fn.Time = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.profileLocked(student)
+	rest, _ := without(p.Recent, fn.Code)
+	p.Recent = append([]Function{fn}, rest[:min(len(rest), MaxRecent-1)]...)
+	s.dirty = true
+}
+
+// 保存學生最近一次取得的課表
+func (s *Store) SaveTimetable(student string, data json.RawMessage) {
+	if student == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.profileLocked(student)
+	p.Timetable = append(json.RawMessage{}, data...)
+	p.TimetableUpdated = time.Now()
+	s.dirty = true
+}
+
+// 取得學生最近一次保存的課表與保存時間
+func (s *Store) Timetable(student string) (json.RawMessage, time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.profiles[student]
+	if p == nil || len(p.Timetable) == 0 {
+		return nil, time.Time{}, false
+	}
+	return append(json.RawMessage{}, p.Timetable...), p.TimetableUpdated, true
+}
+
+func (s *Store) profileLocked(student string) *Profile {
+	p := s.profiles[student]
+	if p == nil {
+		p = &Profile{}
+		s.profiles[student] = p
+	}
+	return p
+}
+
+// 移除指定代碼的功能，回傳新切片與是否曾存在
+func without(list []Function, code string) ([]Function, bool) {
+	rest := make([]Function, 0, len(list))
+	found := false
+	for _, fn := range list {
+		if strings.EqualFold(fn.Code, code) {
+			found = true
+			continue
+		}
+		rest = append(rest, fn)
+	}
+	return rest, found
+}
+
+// 將變更寫回檔案；未設定檔案或沒有變更時不做事
+func (s *Store) Flush() error {
+	if s.file == "" {
+		return nil
+	}
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(snapshot{Profiles: s.profiles}, "", "  ")
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("序列化 session store 失敗: %w", err)
+	}
+
+	err = writeFileAtomic(s.file, data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushErr = err
+	if err != nil {
+		s.dirty = true // 下次再試
+		return fmt.Errorf("寫回 session store 失敗: %w", err)
+	}
+	return nil
+}
+
+// 先寫入暫存檔再改名，避免中途失敗留下不完整的檔案
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// 定期寫回檔案，直到 ctx 結束
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	if s.file == "" || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Printf("⚠️  %v", err)
+			}
+		}
+	}
+}
+
+// 就緒檢查：最近一次寫回失敗時回報錯誤
+func (s *Store) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushErr
+}
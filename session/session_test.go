@@ -0,0 +1,122 @@
+package session
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpectIdentify(t *testing.T) {
+	tests := []struct {
+		name        string
+		pending     string // 登入表單送出的學號，空字串表示沒有經代理登入
+		pageStudent string
+		pageName    string
+		confirmed   bool
+		wantStudent string
+		wantName    string
+		wantState   State
+	}{
+		{
+			name:        "頁面學號與登入表單相符",
+			pending:     "U11016001",
+			pageStudent: "u11016001",
+			pageName:    "王小明",
+			confirmed:   true,
+			wantStudent: "U11016001",
+			wantName:    "王小明",
+			wantState:   StateLoggedIn,
+		},
+		{
+			name:        "頁面學號與登入表單不符",
+			pending:     "U11016001",
+			pageStudent: "U22222222",
+			pageName:    "李小華",
+			wantState:   StateUnknown,
+		},
+		{
+			name:        "沒有待確認的學號時不採用頁面上的學號",
+			pageStudent: "U22222222",
+			pageName:    "李小華",
+			wantState:   StateUnknown,
+		},
+		{
+			name:      "頁面只有姓名時維持待確認",
+			pending:   "U11016001",
+			pageName:  "王小明",
+			wantState: StateUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := Open("")
+			s.mu.Lock()
+			s.entryLocked("sid", time.Now())
+			s.mu.Unlock()
+			s.Expect("sid", tt.pending)
+
+			if got := s.Identify("sid", tt.pageStudent, tt.pageName); got != tt.confirmed {
+				t.Errorf("Identify() = %v, want %v", got, tt.confirmed)
+			}
+			info, _ := s.Info("sid")
+			if info.Student != tt.wantStudent || info.Name != tt.wantName || info.State != tt.wantState {
+				t.Errorf("Info() = 學號 %q 姓名 %q 狀態 %q, want %q %q %q",
+					info.Student, info.Name, info.State, tt.wantStudent, tt.wantName, tt.wantState)
+			}
+			if student, ok := s.Student("sid"); ok != (tt.wantStudent != "") || student != tt.wantStudent {
+				t.Errorf("Student() = %q, %v", student, ok)
+			}
+		})
+	}
+}
+
+func TestIdentifyAfterConfirmation(t *testing.T) {
+	s, _ := Open("")
+	s.Expect("sid", "U11016001")
+	if !s.Identify("sid", "U11016001", "") {
+		t.Fatal("Identify() 未確認相符的學號")
+	}
+
+	// 確認後頁面上出現其他學號（例如名冊），不覆寫學號也不採用姓名
+	if s.Identify("sid", "U22222222", "李小華") {
+		t.Error("Identify() 不應再次確認")
+	}
+	if info, _ := s.Info("sid"); info.Student != "U11016001" || info.Name != "" {
+		t.Errorf("Info() = 學號 %q 姓名 %q，預期維持 U11016001 且沒有姓名", info.Student, info.Name)
+	}
+
+	// 只有姓名的 banner 補上姓名
+	s.Identify("sid", "", "王小明")
+	if info, _ := s.Info("sid"); info.Name != "王小明" {
+		t.Errorf("Info().Name = %q, want 王小明", info.Name)
+	}
+
+	// 同一個 session 改以其他學號登入時清除舊的對應
+	s.Expect("sid", "U33333333")
+	if _, ok := s.Student("sid"); ok {
+		t.Error("重新送出登入表單後，確認前不應有學號")
+	}
+}
+
+func TestPruneKeepsRecentSessions(t *testing.T) {
+	s, _ := Open("")
+	now := time.Now()
+	for i := range maxSessions {
+		s.sessions[strconv.Itoa(i)] = &Info{State: StateLoggedIn, LastSeen: now.Add(time.Duration(i-maxSessions) * time.Second)}
+	}
+
+	s.mu.Lock()
+	s.entryLocked("new", now)
+	s.mu.Unlock()
+
+	if got, want := len(s.sessions), maxSessions/2+1; got != want {
+		t.Fatalf("清除後剩 %d 個 session, want %d", got, want)
+	}
+	for i := range maxSessions {
+		_, ok := s.sessions[strconv.Itoa(i)]
+		if recent := i >= maxSessions/2; ok != recent {
+			t.Fatalf("session %d 保留 = %v，預期只保留最近使用的一半", i, ok)
+		}
+	}
+}
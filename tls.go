@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin"
+)
+
+// 憑證檔案變動後等待多久才重新載入，避免憑證與金鑰只更新一半
+const certReloadDebounce = 500 * time.Millisecond
+
+// 從檔案載入 TLS 憑證，檔案變動時自動重新載入，不需重啟
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// 載入憑證與金鑰；失敗時保留原本的憑證
+func (c *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("載入 TLS 憑證失敗: %w", err)
+	}
+	if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+		cert.Leaf = leaf
+		log.Printf("🔒 已載入 TLS 憑證: %v（到期 %s）", leaf.DNSNames, leaf.NotAfter.Format(time.DateOnly))
+		if time.Until(leaf.NotAfter) < 14*24*time.Hour {
+			log.Printf("⚠️  TLS 憑證將於 %s 到期", leaf.NotAfter.Format(time.DateTime))
+		}
+	}
+	c.cert.Store(&cert)
+	return nil
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// 監看憑證與金鑰所在目錄（憑證更新工具多以改名或替換 symlink 的方式寫入），直到 ctx 結束
+func (c *certReloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dirs := map[string]bool{filepath.Dir(c.certFile): true, filepath.Dir(c.keyFile): true}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				debounce = time.After(certReloadDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("⚠️  監看 TLS 憑證發生錯誤: %v", err)
+			case <-debounce:
+				debounce = nil
+				if err := c.load(); err != nil {
+					log.Printf("❌ %v，繼續使用原憑證", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// 建立使用可重新載入憑證的 TLS 設定
+func newTLSServerConfig(certs *certReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+}
+
+// 將 HTTP 請求以相同路徑轉址到 HTTPS 埠
+func httpsRedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			// 沒有埠號；IPv6 位址仍帶著方括號（[::1]），先去除以免重複加上
+			host = strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		// 非 GET/HEAD 以 308 轉址，讓瀏覽器保留方法與 body
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
+
+// 經 TLS 的回應加上 Strict-Transport-Security
+func hstsMiddleware(maxAge time.Duration, includeSubdomains bool) gin.HandlerFunc {
+	value := "max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return func(c *gin.Context) {
+		if c.Request.TLS != nil {
+			c.Header("Strict-Transport-Security", value)
+		}
+		c.Next()
+	}
+}
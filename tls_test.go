@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		method    string
+		host      string
+		httpsPort int
+		want      string
+		code      int
+	}{
+		{http.MethodGet, "myut.example.com", 443, "https://myut.example.com/utaipei/index_sky.html?a=1", http.StatusMovedPermanently},
+		{http.MethodGet, "myut.example.com:8080", 443, "https://myut.example.com/utaipei/index_sky.html?a=1", http.StatusMovedPermanently},
+		{http.MethodGet, "myut.example.com:8080", 8443, "https://myut.example.com:8443/utaipei/index_sky.html?a=1", http.StatusMovedPermanently},
+		{http.MethodHead, "127.0.0.1", 8443, "https://127.0.0.1:8443/utaipei/index_sky.html?a=1", http.StatusMovedPermanently},
+		{http.MethodGet, "[::1]:8080", 8443, "https://[::1]:8443/utaipei/index_sky.html?a=1", http.StatusMovedPermanently},
+		{http.MethodGet, "[::1]", 8443, "https://[::1]:8443/utaipei/index_sky.html?a=1", http.StatusMovedPermanently},
+		{http.MethodGet, "[::1]", 443, "https://[::1]/utaipei/index_sky.html?a=1", http.StatusMovedPermanently},
+		{http.MethodPost, "myut.example.com", 443, "https://myut.example.com/utaipei/index_sky.html?a=1", http.StatusPermanentRedirect},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "http://placeholder/utaipei/index_sky.html?a=1", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		httpsRedirectHandler(tt.httpsPort).ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%s %s (port %d): 狀態碼 = %d, want %d", tt.method, tt.host, tt.httpsPort, w.Code, tt.code)
+		}
+		if got := w.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s %s (port %d): Location = %q, want %q", tt.method, tt.host, tt.httpsPort, got, tt.want)
+		}
+	}
+}
+
+func TestHSTSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(hstsMiddleware(180*24*time.Hour, true))
+	router.GET("/healthz", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	tlsServer := httptest.NewTLSServer(router)
+	defer tlsServer.Close()
+	resp, err := tlsServer.Client().Get(tlsServer.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, want := resp.Header.Get("Strict-Transport-Security"), "max-age=15552000; includeSubDomains"; got != want {
+		t.Errorf("HTTPS 回應的 Strict-Transport-Security = %q, want %q", got, want)
+	}
+
+	plainServer := httptest.NewServer(router)
+	defer plainServer.Close()
+	resp, err = http.Get(plainServer.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("HTTP 回應不應有 Strict-Transport-Security，得到 %q", got)
+	}
+}
+
+func TestCertReloaderHotReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "first.myut.test")
+
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := certs.Watch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = newTLSServerConfig(certs)
+	server.StartTLS()
+	defer server.Close()
+
+	if got := servedCommonName(t, server); got != "first.myut.test" {
+		t.Fatalf("憑證 CN = %q, want first.myut.test", got)
+	}
+
+	// 憑證更新工具替換檔案後，不需重啟即改用新憑證
+	writeTestCert(t, certFile, keyFile, "second.myut.test")
+	deadline := time.Now().Add(5 * time.Second)
+	for servedCommonName(t, server) != "second.myut.test" {
+		if time.Now().After(deadline) {
+			t.Fatal("憑證檔案更新後未重新載入")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// 載入失敗時保留原本的憑證
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * certReloadDebounce)
+	if got := servedCommonName(t, server); got != "second.myut.test" {
+		t.Errorf("憑證損毀後 CN = %q，預期繼續使用 second.myut.test", got)
+	}
+}
+
+// 以 SNI 連線（讓伺服器改用 GetCertificate 提供的憑證）並取得憑證的 CN
+func servedCommonName(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{
+		ServerName:         "myut.test",
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+// 產生自簽憑證並寫入檔案
+func writeTestCert(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName, "myut.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
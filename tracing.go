@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 全域 tracer，未啟用追蹤時為 no-op 實作
+var tracer = otel.Tracer("better-myUT")
+
+// 交給 myUT 代理的路由，span 名稱統一為「METHOD proxy」
+const proxyRoute = "/utaipei/*proxyPath"
+
+// 初始化 OpenTelemetry 追蹤
+//
+// tracing.exporter 決定匯出方式：
+//   - otlp：以 OTLP/HTTP 送往 collector 的 /v1/traces（tracing.endpoint 與標準變數
+//     OTEL_EXPORTER_OTLP_ENDPOINT 同為基底位址；未設定時由匯出器自行讀取 OTEL_EXPORTER_OTLP_* 變數）
+//   - stdout：輸出到標準輸出，方便本機除錯
+//   - file：寫入 tracing.file 指定的檔案，方便測試比對
+//   - none 或未設定：不啟用追蹤
+//
+// 回傳的函數需在程式結束前呼叫，以送出尚未匯出的 span。
+func initTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	// 不論是否匯出，一律使用 W3C traceparent 傳遞追蹤資訊
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	exporterName := strings.ToLower(strings.TrimSpace(cfg.Exporter))
+
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+	switch exporterName {
+	case "", "none":
+		log.Printf("未啟用 OpenTelemetry 追蹤")
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(tracesEndpoint(cfg.Endpoint)))
+		}
+		if headers := parseHeaderList(cfg.Headers); len(headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(headers))
+		}
+		exp, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("建立 OTLP 匯出器失敗: %v", err)
+		}
+		exporter = exp
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("建立 stdout 匯出器失敗: %v", err)
+		}
+		exporter = exp
+	case "file":
+		path := cfg.File
+		if path == "" {
+			path = "traces.json"
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("開啟追蹤檔案失敗: %v", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("建立檔案匯出器失敗: %v", err)
+		}
+		exporter = exp
+		closeFile = f.Close
+	default:
+		return nil, fmt.Errorf("不支援的追蹤匯出方式: %s", exporterName)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "better-myUT"
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("建立追蹤資源失敗: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	log.Printf("已啟用 OpenTelemetry 追蹤 (匯出器: %s, 服務名稱: %s)", exporterName, serviceName)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeFile != nil {
+			if cerr := closeFile(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+// WithEndpointURL 會原樣使用網址路徑；endpoint 比照 OTEL_EXPORTER_OTLP_ENDPOINT 視為基底位址，
+// 在路徑後加上 /v1/traces（已指定完整路徑時不重複加上）
+func tracesEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), "/v1/traces") {
+		return endpoint
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/traces"
+	return u.String()
+}
+
+// 解析 "key=value,key2=value2" 格式的標頭清單（與 OTEL_EXPORTER_OTLP_HEADERS 相同，值可經 URL 編碼）
+func parseHeaderList(raw string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if decoded, err := url.QueryUnescape(value); err == nil {
+			value = decoded
+		}
+		headers[strings.TrimSpace(key)] = value
+	}
+	return headers
+}
+
+// Gin 中間件：為每個進站請求建立 server span，並承接上游傳來的 traceparent
+//
+// span 以路由命名，不使用實際路徑：路徑可能含有訂閱 token 等憑證，也會讓 span 名稱無限增加。
+// 查詢字串可能帶有學生資料，一律不記錄；只有代理路由記錄校務系統頁面的路徑。
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		attrs := []attribute.KeyValue{
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("user_agent.original", c.Request.UserAgent()),
+		}
+		name := c.Request.Method + " " + route
+		switch route {
+		case "":
+			name = c.Request.Method + " unmatched"
+		case proxyRoute:
+			name = c.Request.Method + " proxy"
+			attrs = append(attrs, attribute.String("url.path", c.Request.URL.Path))
+		}
+		if route != "" {
+			attrs = append(attrs, attribute.String("http.route", route))
+		}
+
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrs...),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+	}
+}
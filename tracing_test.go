@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// file 匯出器輸出的 span（只取用到的欄位）
+type exportedSpan struct {
+	Name       string
+	Attributes []struct {
+		Key   string
+		Value struct {
+			Value any
+		}
+	}
+}
+
+func (s exportedSpan) attr(key string) (string, bool) {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			v, _ := a.Value.Value.(string)
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := initTracing(context.Background(), TracingConfig{Exporter: "file", File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(tracingMiddleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/v1/timetable/feed/:token", ok)
+	router.Any(proxyRoute, ok)
+
+	for _, target := range []string{
+		"/api/v1/timetable/feed/VTExMDE2MDAx.c2lnbmF0dXJl.ics?start=2025-09-08",
+		"/utaipei/ag_pro/ag008.jsp?stno=U11016001",
+		"/no/such/page?secret=1",
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := readSpans(t, file)
+	if len(spans) != 3 {
+		t.Fatalf("匯出 %d 個 span, want 3", len(spans))
+	}
+
+	want := []struct {
+		name  string
+		route string
+		path  string // 空字串表示不應記錄 url.path
+	}{
+		{"GET /api/v1/timetable/feed/:token", "/api/v1/timetable/feed/:token", ""},
+		{"GET proxy", proxyRoute, "/utaipei/ag_pro/ag008.jsp"},
+		{"GET unmatched", "", ""},
+	}
+	for i, w := range want {
+		span := spans[i]
+		if span.Name != w.name {
+			t.Errorf("span[%d] 名稱 = %q, want %q", i, span.Name, w.name)
+		}
+		if route, _ := span.attr("http.route"); route != w.route {
+			t.Errorf("span[%d] http.route = %q, want %q", i, route, w.route)
+		}
+		if path, _ := span.attr("url.path"); path != w.path {
+			t.Errorf("span[%d] url.path = %q, want %q", i, path, w.path)
+		}
+		if _, ok := span.attr("url.query"); ok {
+			t.Errorf("span[%d] 不應記錄 url.query", i)
+		}
+	}
+
+	// 訂閱 token 與查詢字串中的學號不可出現在追蹤資料中
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"VTExMDE2MDAx", "U11016001", "secret=1"} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("追蹤資料含有 %q", secret)
+		}
+	}
+}
+
+func readSpans(t *testing.T, file string) []exportedSpan {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var spans []exportedSpan
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var span exportedSpan
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("無法解析 span: %v", err)
+		}
+		spans = append(spans, span)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return spans
+}
+
+func TestTracesEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"http://localhost:4318":                   "http://localhost:4318/v1/traces",
+		"http://localhost:4318/":                  "http://localhost:4318/v1/traces",
+		"https://collector.example.com/otlp":      "https://collector.example.com/otlp/v1/traces",
+		"https://collector.example.com/v1/traces": "https://collector.example.com/v1/traces",
+	}
+	for in, want := range tests {
+		if got := tracesEndpoint(in); got != want {
+			t.Errorf("tracesEndpoint(%q) = %q, want %q", in, got, want)
+		}
+	}
+}